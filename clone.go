@@ -0,0 +1,80 @@
+package loadcfg
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Clone returns a deep copy of obj which must be a pointer to a struct. Maps,
+// slices and pointers are all copied so that modifying the clone never affects
+// the original. Unexported fields are copied shallowly.
+func Clone(obj interface{}) (interface{}, error) {
+	val := reflect.ValueOf(obj)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return nil, fmt.Errorf("%w: clone requires a non-nil pointer but got: %T", ErrUnsupportedType, obj)
+	}
+
+	return deepCopy(val).Interface(), nil
+}
+
+func deepCopy(val reflect.Value) reflect.Value {
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+
+		newVal := reflect.New(val.Type().Elem())
+		newVal.Elem().Set(deepCopy(val.Elem()))
+		return newVal
+	case reflect.Struct:
+		// Copying the whole struct first takes care of unexported fields
+		newVal := reflect.New(val.Type()).Elem()
+		newVal.Set(val)
+
+		n := val.NumField()
+		for i := 0; i < n; i++ {
+			if field := newVal.Field(i); field.CanSet() {
+				field.Set(deepCopy(val.Field(i)))
+			}
+		}
+		return newVal
+	case reflect.Map:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+
+		newVal := reflect.MakeMapWithSize(val.Type(), val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			newVal.SetMapIndex(deepCopy(iter.Key()), deepCopy(iter.Value()))
+		}
+		return newVal
+	case reflect.Slice:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+
+		newVal := reflect.MakeSlice(val.Type(), val.Len(), val.Len())
+		for i := 0; i < val.Len(); i++ {
+			newVal.Index(i).Set(deepCopy(val.Index(i)))
+		}
+		return newVal
+	case reflect.Array:
+		newVal := reflect.New(val.Type()).Elem()
+		for i := 0; i < val.Len(); i++ {
+			newVal.Index(i).Set(deepCopy(val.Index(i)))
+		}
+		return newVal
+	case reflect.Interface:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+
+		newVal := reflect.New(val.Type()).Elem()
+		newVal.Set(deepCopy(val.Elem()))
+		return newVal
+	}
+
+	return val
+}
@@ -0,0 +1,58 @@
+package loadcfg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClone(t *testing.T) {
+	t.Parallel()
+
+	int5 := 5
+	orig := &A{
+		Int:        5,
+		IntPtr:     &int5,
+		Strings:    []string{"one", "two"},
+		Time:       time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC),
+		Map:        map[string]B{"one": {Float: 4.5}},
+		MapPtr:     map[string]*B{"one": {Float: 4.5}},
+		MapPrimPtr: map[string]*int{"one": &int5},
+		Slice:      []B{{Float: 4.5}},
+		SlicePtr:   []*B{{Float: 4.5}},
+		StructPtr:  &B{Float: 4.5},
+	}
+	orig.Embedded.Int = 6
+
+	obj, err := Clone(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone := obj.(*A)
+	if !reflect.DeepEqual(orig, clone) {
+		t.Fatalf("clone differs:\nwant:\n%v\n\ngot:\n%v\n", orig, clone)
+	}
+
+	*clone.IntPtr = 6
+	clone.Strings[0] = "three"
+	clone.Map["one"] = B{Float: 5.5}
+	clone.MapPtr["one"].Float = 5.5
+	*clone.MapPrimPtr["one"] = 6
+	clone.Slice[0].Float = 5.5
+	clone.SlicePtr[0].Float = 5.5
+	clone.StructPtr.Float = 5.5
+	clone.Embedded.Int = 7
+
+	if *orig.IntPtr != 5 || orig.Strings[0] != "one" || orig.Map["one"].Float != 4.5 ||
+		orig.MapPtr["one"].Float != 4.5 || *orig.MapPrimPtr["one"] != 5 ||
+		orig.Slice[0].Float != 4.5 || orig.SlicePtr[0].Float != 4.5 ||
+		orig.StructPtr.Float != 4.5 || orig.Embedded.Int != 6 {
+		t.Errorf("original was modified: %v", orig)
+	}
+
+	if _, err := Clone(A{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("expected an error for a non-pointer:", err)
+	}
+}
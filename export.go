@@ -0,0 +1,199 @@
+package loadcfg
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportEnv writes a shell script of export statements to w that would
+// recreate obj's values if it were loaded from the env with the same prefix.
+// Every scalar value is written, including map and slice elements, times are
+// written as RFC3339 and slices of scalars as comma separated lists.
+// Interface map values are written as their TYPE followed by their fields.
+//
+// Values that couldn't be loaded back are left out: map entries whose key has
+// an underscore or uppercase letters (env names are split on underscores and
+// map keys are lowercased), empty strings (empty env vars are ignored) and
+// interface values whose type wasn't registered with RegisterType.
+func ExportEnv(w io.Writer, envPrefix, structTag string, obj interface{}) error {
+	var lines []string
+	exportEnvHelper(structTag, nil, reflect.ValueOf(obj), &lines)
+
+	pfxUnderscore := prefixUnderscore(envPrefix)
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "export %s%s\n", pfxUnderscore, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func exportEnvHelper(tag string, path []string, val reflect.Value, lines *[]string) {
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return
+		}
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Interface:
+		if val.IsNil() || len(path) == 0 {
+			return
+		}
+
+		name, ok := registeredName(val.Elem().Type())
+		if !ok {
+			return
+		}
+
+		typePath := cloneAndAppend(path, typeSegment)
+		*lines = append(*lines, strings.ToUpper(strings.Join(typePath, "_"))+"="+shellQuote(name))
+		exportEnvHelper(tag, path, val.Elem(), lines)
+		return
+	case reflect.Struct:
+		if isLeafStruct(val.Type()) {
+			break
+		}
+
+		typ := val.Type()
+		n := typ.NumField()
+		for i := 0; i < n; i++ {
+			field := typ.Field(i)
+			name, opts, ok := envTag(field, tag)
+			if !ok || len(field.PkgPath) != 0 {
+				continue
+			}
+
+			fieldPath := cloneAndAppend(path, name)
+			if opts.has("squash") {
+				fieldPath = path
+			}
+
+			exportEnvHelper(tag, fieldPath, val.Field(i), lines)
+		}
+
+		return
+	case reflect.Map:
+		if isSetter(val.Type()) {
+			break
+		}
+
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			name := k.String()
+			if len(name) == 0 || strings.Contains(name, "_") || name != strings.ToLower(name) {
+				continue
+			}
+			exportEnvHelper(tag, cloneAndAppend(path, name), val.MapIndex(k), lines)
+		}
+
+		return
+	case reflect.Slice:
+		if val.IsNil() {
+			return
+		}
+		if isSetter(val.Type()) {
+			break
+		}
+
+		elemType := val.Type().Elem()
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+
+		switch elemType.Kind() {
+		case reflect.Map, reflect.Struct, reflect.Slice:
+			if isLeafStruct(elemType) {
+				break
+			}
+
+			for i := 0; i < val.Len(); i++ {
+				exportEnvHelper(tag, cloneAndAppend(path, strconv.Itoa(i)), val.Index(i), lines)
+			}
+			return
+		}
+	}
+
+	if len(path) == 0 {
+		return
+	}
+
+	value := exportValue(val)
+	if len(value) == 0 {
+		return
+	}
+
+	name := strings.ToUpper(strings.Join(path, "_"))
+	*lines = append(*lines, name+"="+shellQuote(value))
+}
+
+// exportValue formats a value the same way it would be parsed from env
+func exportValue(val reflect.Value) string {
+	if val.Kind() == reflect.Slice {
+		if val.Len() == 0 {
+			return "[]"
+		}
+
+		elems := make([]string, 0, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			elem := val.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				// There's no way to write a nil element so it's left out
+				if elem.IsNil() {
+					continue
+				}
+				elem = elem.Elem()
+			}
+
+			s := exportValue(elem)
+			// Quote CSV style so elements with commas survive a round trip
+			if strings.ContainsAny(s, `,"`) {
+				s = `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+			}
+			elems = append(elems, s)
+		}
+		return strings.Join(elems, ",")
+	}
+
+	if i, ok := embeddedTime(val.Type()); ok {
+		val = val.Field(i)
+	}
+
+	switch v := val.Interface().(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	return fmt.Sprint(val.Interface())
+}
+
+// shellQuote single quotes s unless it's made up of characters that are
+// safe to use in a shell unquoted
+func shellQuote(s string) string {
+	safe := len(s) != 0
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-.,:/+@%", r)) {
+			safe = false
+			break
+		}
+	}
+
+	if safe {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
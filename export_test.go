@@ -0,0 +1,240 @@
+package loadcfg
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportEnv(t *testing.T) {
+	t.Parallel()
+
+	int3, int5 := 3, 5
+	obj := &A{
+		Int:        5,
+		IntPtr:     &int5,
+		Strings:    []string{"one", "two three"},
+		Time:       time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC),
+		Map:        map[string]B{"two": {Float: 5.5}, "one": {Float: 4.5}},
+		MapPtr:     map[string]*B{"one": {Float: 6.5}},
+		MapPrim:    map[string]int{"one": 1},
+		MapPrimPtr: map[string]*int{"one": &int3},
+		Slice:      []B{{Float: 8.5}, {Float: 9.5}},
+		SlicePtr:   []*B{{Float: 10.5}},
+		Struct:     B{Float: 12.5},
+		Ignored:    &B{Float: 1},
+	}
+	obj.Embedded.Int = 6
+
+	buf := &bytes.Buffer{}
+	if err := ExportEnv(buf, "app", "toml", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `export APP_INT=5
+export APP_INTPTR=5
+export APP_STRINGS='one,two three'
+export APP_TIME=2009-11-10T23:00:00Z
+export APP_EMBEDDED_INT=6
+export APP_MAP_ONE_FLOAT=4.5
+export APP_MAP_TWO_FLOAT=5.5
+export APP_MAPPTR_ONE_FLOAT=6.5
+export APP_MAPPRIM_ONE=1
+export APP_MAPPRIMPTR_ONE=3
+export APP_SLICE_0_FLOAT=8.5
+export APP_SLICE_1_FLOAT=9.5
+export APP_SLICEPTR_0_FLOAT=10.5
+export APP_STRUCT_FLOAT=12.5
+`
+	if got := buf.String(); got != want {
+		t.Errorf("export wrong\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	// The export should load back into the same struct
+	envs := fakeEnvs(
+		"APP_STRINGS", "one,two three",
+	)
+	for _, line := range strings.Split(strings.TrimSpace(want), "\n") {
+		if kv := strings.TrimPrefix(line, "export "); !strings.HasPrefix(kv, "APP_STRINGS=") {
+			envs = append(envs, kv)
+		}
+	}
+
+	var l Loader
+	pseudoKeys, err := l.envPseudoKeys("toml", obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(A)
+	if err := l.overwriteStructVals("toml", l.findKeyValues(envs, "app", pseudoKeys), got); err != nil {
+		t.Fatal(err)
+	}
+
+	obj.Ignored = nil
+	if !reflect.DeepEqual(obj, got) {
+		t.Errorf("round trip differs:\nwant:\n%v\n\ngot:\n%v\n", obj, got)
+	}
+}
+
+func TestExportEnvQuotedSlice(t *testing.T) {
+	t.Parallel()
+
+	obj := &struct {
+		Strings []string `toml:"strings"`
+	}{Strings: []string{"a,b", "c"}}
+
+	buf := &bytes.Buffer{}
+	if err := ExportEnv(buf, "app", "toml", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := `export APP_STRINGS='"a,b",c'`+"\n", buf.String(); got != want {
+		t.Errorf("export wrong\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestExportEnvPointerSlice(t *testing.T) {
+	t.Parallel()
+
+	one, two, name := 1, 2, "a,b"
+	obj := &struct {
+		Ptrs    []*int    `toml:"ptrs"`
+		Strings []*string `toml:"strings"`
+	}{
+		Ptrs:    []*int{&one, nil, &two},
+		Strings: []*string{&name},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ExportEnv(buf, "app", "toml", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "export APP_PTRS=1,2\nexport APP_STRINGS='\"a,b\"'\n"
+	if got := buf.String(); got != want {
+		t.Errorf("export wrong\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestExportEnvTimeWrapper(t *testing.T) {
+	t.Parallel()
+
+	obj := &struct {
+		Created timestamp `toml:"created"`
+	}{Created: timestamp{time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)}}
+
+	buf := &bytes.Buffer{}
+	if err := ExportEnv(buf, "app", "toml", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "export APP_CREATED=2009-11-10T23:00:00Z\n", buf.String(); got != want {
+		t.Errorf("export wrong\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+type unregisteredPlugin struct {
+	H int `toml:"h"`
+}
+
+func (u *unregisteredPlugin) Name() string { return "unregistered" }
+
+func TestExportEnvInterfaceMap(t *testing.T) {
+	t.Parallel()
+
+	obj := &pluginConfig{Plugins: map[string]plugin{
+		"cache": &redisPlugin{Addr: "localhost:6379", DB: 2},
+		"logs":  &filePlugin{Path: "/var/log/app"},
+		"other": &unregisteredPlugin{H: 1},
+		"nil":   nil,
+	}}
+
+	buf := &bytes.Buffer{}
+	if err := ExportEnv(buf, "app", "toml", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `export APP_PLUGINS_CACHE_TYPE=redis
+export APP_PLUGINS_CACHE_ADDR=localhost:6379
+export APP_PLUGINS_CACHE_DB=2
+export APP_PLUGINS_LOGS_TYPE=file
+export APP_PLUGINS_LOGS_PATH=/var/log/app
+`
+	if got := buf.String(); got != want {
+		t.Errorf("export wrong\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	var envs []string
+	for _, line := range strings.Split(strings.TrimSpace(want), "\n") {
+		envs = append(envs, strings.TrimPrefix(line, "export "))
+	}
+
+	l := Loader{Environ: envs}
+	got := new(pluginConfig)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(obj.Plugins, "other")
+	delete(obj.Plugins, "nil")
+	if !reflect.DeepEqual(obj, got) {
+		t.Errorf("round trip differs:\nwant:\n%#v\n\ngot:\n%#v\n", obj.Plugins, got.Plugins)
+	}
+}
+
+func TestExportEnvRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Name  string       `toml:"name"`
+		Empty string       `toml:"empty"`
+		Map   map[string]B `toml:"map"`
+	}
+
+	obj := &Config{
+		Name: "it's",
+		Map: map[string]B{
+			"west":    {Float: 1.5},
+			"us_east": {Float: 2.5},
+			"EuWest":  {Float: 3.5},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ExportEnv(buf, "app", "toml", obj); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `export APP_NAME='it'\''s'
+export APP_MAP_WEST_FLOAT=1.5
+`
+	if got := buf.String(); got != want {
+		t.Errorf("export wrong\nwant:\n%s\ngot:\n%s", want, got)
+	}
+
+	// Undo the shell quoting to get back the env
+	var envs []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		name, value, _ := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if strings.HasPrefix(value, "'") {
+			value = strings.ReplaceAll(value[1:len(value)-1], `'\''`, "'")
+		}
+		envs = append(envs, name+"="+value)
+	}
+
+	l := Loader{Environ: envs}
+	got := new(Config)
+	noFile := func(interface{}) error { return nil }
+	if err := l.Load("app", "toml", noFile, got); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(obj.Map, "us_east")
+	delete(obj.Map, "EuWest")
+	if !reflect.DeepEqual(obj, got) {
+		t.Errorf("round trip differs:\nwant:\n%#v\n\ngot:\n%#v\n", obj, got)
+	}
+}
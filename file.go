@@ -0,0 +1,62 @@
+package loadcfg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile decodes filename into obj using a decoder picked by the file's
+// extension (.toml, .json, .yaml or .yml) and then applies the environment
+// overrides. As with TOML there is no error if the file does not exist, but
+// an unknown extension is always an error.
+//
+// structTag only names fields for the env, each file format is decoded with
+// its own tags: toml for .toml, json for .json (matched without case) and
+// yaml for .yaml and .yml, falling back to the field name like encoding/json
+// and yaml.v3 do. A struct with only toml tags like `toml:"max_conns"` can't
+// be set from max_conns in a JSON or YAML file, give it json and yaml tags as
+// well.
+func LoadFile(envPrefix, structTag, filename string, obj interface{}) error {
+	var l Loader
+	return l.LoadFile(envPrefix, structTag, filename, obj)
+}
+
+// LoadFile is the same as the package level LoadFile but uses the Loader's
+// options.
+func (l *Loader) LoadFile(envPrefix, structTag, filename string, obj interface{}) error {
+	var unmarshal func(data []byte, obj interface{}) error
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".toml":
+		// Keep the metadata so filewins still works
+		return l.load(envPrefix, structTag, obj, func() (*toml.MetaData, error) {
+			m, err := toml.DecodeFile(filename, obj)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			return &m, nil
+		})
+	case ".json":
+		unmarshal = json.Unmarshal
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	default:
+		return fmt.Errorf("%w: unknown config file extension: %q", ErrUnsupportedType, ext)
+	}
+
+	return l.Load(envPrefix, structTag, func(obj interface{}) error {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		return unmarshal(data, obj)
+	}, obj)
+}
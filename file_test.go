@@ -0,0 +1,83 @@
+package loadcfg
+
+import (
+	"errors"
+	"testing"
+)
+
+type fileConfig struct {
+	Int  int     `toml:"int" json:"int" yaml:"int"`
+	Port int     `toml:"port" json:"port" yaml:"port"`
+	Rate float64 `toml:"rate" json:"rate" yaml:"rate"`
+}
+
+func TestLoadFile(t *testing.T) {
+	keys := setEnvs("TEST39_PORT", "8080")
+
+	defer unsetEnvs(keys)
+
+	files := []string{
+		"testdata/config.toml",
+		"testdata/config.json",
+		"testdata/config.yaml",
+		"testdata/config.yml",
+	}
+
+	for _, file := range files {
+		got := new(fileConfig)
+		if err := LoadFile("test39", "toml", file, got); err != nil {
+			t.Errorf("%s) %v", file, err)
+			continue
+		}
+
+		if want := (fileConfig{Int: 5, Port: 8080, Rate: 4.5}); *got != want {
+			t.Errorf("%s) wrong, want: %v, got: %v", file, want, *got)
+		}
+	}
+
+	// A missing file only loads the env
+	got := new(fileConfig)
+	if err := LoadFile("test39", "toml", "testdata/missing.json", got); err != nil {
+		t.Error(err)
+	}
+	if got.Port != 8080 {
+		t.Error("port wrong:", got.Port)
+	}
+
+	err := LoadFile("test39", "toml", "testdata/config.ini", new(fileConfig))
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Error("expected an error for an unknown extension:", err)
+	}
+}
+
+func TestLoadFileTOMLTagsOnly(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Int      int `toml:"int"`
+		MaxConns int `toml:"max_conns"`
+	}
+
+	for _, file := range []string{"testdata/tomltags.json", "testdata/tomltags.yaml"} {
+		l := Loader{Environ: []string{}}
+		got := new(Config)
+		if err := l.LoadFile("app", "toml", file, got); err != nil {
+			t.Errorf("%s) %v", file, err)
+			continue
+		}
+
+		// Only the field name matches, the toml tag isn't used by the
+		// json and yaml decoders
+		if want := (Config{Int: 5}); *got != want {
+			t.Errorf("%s) wrong, want: %v, got: %v", file, want, *got)
+		}
+
+		// The env still uses structTag
+		l.Environ = []string{"APP_MAX_CONNS=10"}
+		if err := l.LoadFile("app", "toml", file, got); err != nil {
+			t.Errorf("%s) %v", file, err)
+		} else if got.MaxConns != 10 {
+			t.Errorf("%s) max conns wrong: %d", file, got.MaxConns)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package loadcfg
+
+import (
+	"flag"
+	"strings"
+)
+
+// ApplyFlags sets the values of flags that were explicitly set on the command
+// line into obj. It's meant to be called after loading from a file and env so
+// that the precedence is flags > env > file. Flag names map to struct tag
+// paths by using - or . as separators, eg. -map-one-float or -map.one.float.
+// Like the other loading functions the hooks (Normalize, Validate and
+// required_if) are run once the flags are set.
+func ApplyFlags(structTag string, fs *flag.FlagSet, obj interface{}) error {
+	var l Loader
+	return l.ApplyFlags(structTag, fs, obj)
+}
+
+// ApplyFlags is the same as the package level ApplyFlags but uses the
+// Loader's options.
+func (l *Loader) ApplyFlags(structTag string, fs *flag.FlagSet, obj interface{}) error {
+	pseudoKeys, err := l.envPseudoKeys(structTag, obj)
+	if err != nil {
+		return err
+	}
+
+	// Turn the flags into env vars so they can be matched in the same way.
+	// Empty env values are skipped but a flag set to empty still overrides,
+	// so each name is matched with a placeholder value instead.
+	kvs := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		sep := string(l.separator())
+		name := strings.NewReplacer("-", sep, ".", sep).Replace(strings.ToUpper(f.Name))
+		for key := range l.findKeyValues([]string{name + "=flag"}, "", pseudoKeys) {
+			kvs[key] = f.Value.String()
+		}
+	})
+
+	if err := l.overwriteStructVals(structTag, kvs, obj); err != nil {
+		return err
+	}
+
+	return finish(structTag, obj)
+}
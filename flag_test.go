@@ -0,0 +1,106 @@
+package loadcfg
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestApplyFlags(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("int", 0, "an int")
+	fs.Float64("map-one-float", 0, "a float")
+	fs.Float64("struct.float", 0, "a float")
+
+	if err := fs.Parse([]string{"-map-one-float", "5.5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &A{Int: 5, Struct: B{Float: 4.5}}
+	if err := ApplyFlags("toml", fs, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 5 {
+		t.Error("int should not be overridden by an unset flag:", got.Int)
+	}
+	if got.Struct.Float != 4.5 {
+		t.Error("struct float should not be overridden by an unset flag:", got.Struct.Float)
+	}
+	if g := got.Map["one"].Float; g != 5.5 {
+		t.Error("map float wrong:", g)
+	}
+}
+
+func TestApplyFlagsSeparator(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Port int `toml:"port"`
+	}
+	type Config struct {
+		Srv Server `toml:"srv"`
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("srv-port", 0, "a port")
+	if err := fs.Parse([]string{"-srv-port=7"}); err != nil {
+		t.Fatal(err)
+	}
+
+	l := Loader{Separator: '.'}
+	got := new(Config)
+	if err := l.ApplyFlags("toml", fs, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Srv.Port != 7 {
+		t.Error("port wrong:", got.Srv.Port)
+	}
+}
+
+func TestApplyFlagsHooks(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("host-name", "", "a host")
+	fs.Int("server-port", 0, "a port")
+	if err := fs.Parse([]string{"-host-name=EXAMPLE", "-server-port=70000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	norm := new(normConfig)
+	if err := ApplyFlags("toml", fs, norm); err != nil {
+		t.Fatal(err)
+	}
+	if norm.Host.Name != "example" {
+		t.Error("flags should be normalized:", norm.Host.Name)
+	}
+
+	valid := &validConfig{Name: "app"}
+	if err := ApplyFlags("toml", fs, valid); err == nil {
+		t.Error("expected the port set by a flag to fail validation")
+	}
+}
+
+func TestApplyFlagsEmpty(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Name string `toml:"name"`
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("name", "", "a name")
+	if err := fs.Parse([]string{"-name="}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &Config{Name: "from env"}
+	if err := ApplyFlags("toml", fs, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "" {
+		t.Error("a flag set to empty should override:", got.Name)
+	}
+}
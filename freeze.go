@@ -0,0 +1,47 @@
+package loadcfg
+
+import "fmt"
+
+// Freezer can be implemented by a config type to stop it being loaded into
+// again. Once LoadCfgFrozen returns true any attempt to load into the config,
+// from a file, env or flags, returns an error wrapping ErrFrozen. It's
+// usually implemented by embedding Freezable.
+type Freezer interface {
+	LoadCfgFrozen() bool
+}
+
+// Freezable can be embedded in a config struct to make it a Freezer, Freeze
+// is then called once the config is loaded. This guards security sensitive
+// configs against being overridden by accidentally loading them twice.
+//
+//	type Config struct {
+//	    loadcfg.Freezable
+//
+//	    Token string `toml:"token"`
+//	}
+//
+// The flag is part of the config so it's owned by whoever owns the config and
+// goes away with it, copies of a frozen config are frozen as well. Freeze
+// must not be called while the config is being loaded.
+type Freezable struct {
+	frozen bool
+}
+
+// Freeze marks the config as loaded
+func (f *Freezable) Freeze() {
+	f.frozen = true
+}
+
+// LoadCfgFrozen implements Freezer
+func (f *Freezable) LoadCfgFrozen() bool {
+	return f.frozen
+}
+
+// checkFrozen returns an error if obj has been frozen
+func checkFrozen(obj interface{}) error {
+	if f, ok := obj.(Freezer); ok && f.LoadCfgFrozen() {
+		return fmt.Errorf("%w: %T", ErrFrozen, obj)
+	}
+
+	return nil
+}
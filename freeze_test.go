@@ -0,0 +1,60 @@
+package loadcfg
+
+import (
+	"errors"
+	"flag"
+	"testing"
+)
+
+type frozenConfig struct {
+	Freezable
+
+	Int int          `toml:"int"`
+	Map map[string]B `toml:"map"`
+}
+
+func TestFreeze(t *testing.T) {
+	keys := setEnvs("TEST60_INT", "6")
+
+	defer unsetEnvs(keys)
+
+	got := new(frozenConfig)
+	if _, err := TOML("test60", "testdata/one.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	got.Freeze()
+
+	if err := Env("test60", "toml", got); !errors.Is(err, ErrFrozen) {
+		t.Error("env should fail:", err)
+	}
+	if _, err := TOML("test60", "testdata/filewins.toml", got); !errors.Is(err, ErrFrozen) {
+		t.Error("toml should fail:", err)
+	}
+	if err := Reload("test60", "testdata/one.toml", got); !errors.Is(err, ErrFrozen) {
+		t.Error("reload should fail:", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("int", 0, "")
+	if err := fs.Parse([]string{"-int", "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyFlags("toml", fs, got); !errors.Is(err, ErrFrozen) {
+		t.Error("flags should fail:", err)
+	}
+
+	if got.Int != 6 || len(got.Map) != 2 {
+		t.Error("frozen config was changed:", got.Int, got.Map)
+	}
+
+	// Other objects can still be loaded
+	if err := Env("test60", "toml", new(frozenConfig)); err != nil {
+		t.Error(err)
+	}
+
+	// A copy keeps the flag with it
+	copied := *got
+	if err := Env("test60", "toml", &copied); !errors.Is(err, ErrFrozen) {
+		t.Error("a copy of a frozen config should be frozen:", err)
+	}
+}
@@ -1,5 +1,8 @@
 module github.com/aarondl/loadcfg
 
-go 1.13
+go 1.20
 
-require github.com/BurntSushi/toml v0.3.1
+require (
+	github.com/BurntSushi/toml v0.3.1
+	gopkg.in/yaml.v3 v3.0.1
+)
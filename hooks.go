@@ -0,0 +1,201 @@
+package loadcfg
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Normalizer can be implemented by the config type or the type of any of its
+// fields to clean up values (eg. lowercasing a hostname) after the file and
+// env have been loaded. Nested values are normalized before their parents.
+type Normalizer interface {
+	Normalize() error
+}
+
+// Validator can be implemented by the config type or the type of any of its
+// fields to check its own invariants once loading is complete. Every
+// Validate is called, the errors are all returned together.
+type Validator interface {
+	Validate() error
+}
+
+// finish runs the hooks once obj is fully loaded, normalizing it first so
+// that validation sees the final values.
+func finish(tag string, obj interface{}) error {
+	if err := normalize(tag, obj); err != nil {
+		return err
+	}
+
+	return validate(tag, obj)
+}
+
+// normalize calls Normalize on everything in obj that implements Normalizer
+func normalize(tag string, obj interface{}) error {
+	return walkValues(tag, reflect.ValueOf(obj), func(val reflect.Value) error {
+		if n, ok := interfaceOf(val).(Normalizer); ok {
+			return n.Normalize()
+		}
+		return nil
+	})
+}
+
+// validate calls Validate on everything in obj that implements Validator and
+// joins the errors
+func validate(tag string, obj interface{}) error {
+	var errs []error
+	_ = walkValues(tag, reflect.ValueOf(obj), func(val reflect.Value) error {
+		if val.Kind() == reflect.Struct && !isLeafStruct(val.Type()) {
+			errs = append(errs, requiredIf(tag, val)...)
+		}
+		if v, ok := interfaceOf(val).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return nil
+	})
+
+	return errors.Join(errs...)
+}
+
+// requiredIf checks the required_if options on the fields of the struct val
+func requiredIf(tag string, val reflect.Value) []error {
+	var errs []error
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name, opts, ok := getTag(typ.Field(i), tag)
+		if !ok {
+			continue
+		}
+		cond, ok := opts.value("required_if")
+		if !ok {
+			continue
+		}
+
+		path, want, ok := strings.Cut(cond, ":")
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: required_if must be in the form field:value but got: %s", name, cond))
+			continue
+		}
+
+		other, err := fieldByPath(tag, val, strings.Split(path, "."))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: required_if: %w", name, err))
+			continue
+		}
+
+		if !other.IsValid() || fmt.Sprint(other.Interface()) != want || !val.Field(i).IsZero() {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("%w: %s is required when %s is %s", ErrRequired, name, path, want))
+	}
+
+	return errs
+}
+
+// fieldByPath finds the field with the tag names in path starting from the
+// struct val. The returned value is invalid if a pointer along the way is nil.
+func fieldByPath(tag string, val reflect.Value, path []string) (reflect.Value, error) {
+	for _, seg := range path {
+		if val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				return reflect.Value{}, nil
+			}
+			val = val.Elem()
+		}
+		if val.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%w: %s is not in a struct", ErrFieldNotFound, seg)
+		}
+
+		typ := val.Type()
+		found := false
+		for i := 0; i < typ.NumField(); i++ {
+			if name, _, ok := getTag(typ.Field(i), tag); ok && name == seg && len(typ.Field(i).PkgPath) == 0 {
+				val = val.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("%w: %s", ErrFieldNotFound, seg)
+		}
+	}
+
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return reflect.Value{}, nil
+		}
+		val = val.Elem()
+	}
+
+	return val, nil
+}
+
+// interfaceOf returns a pointer to val if it's addressable so that methods
+// with pointer receivers are found, otherwise val itself.
+func interfaceOf(val reflect.Value) interface{} {
+	if val.CanAddr() {
+		return val.Addr().Interface()
+	}
+	if val.CanInterface() {
+		return val.Interface()
+	}
+
+	return nil
+}
+
+// walkValues calls fn on every value reachable from val through tagged struct
+// fields, maps, slices and pointers. Children are visited before their
+// parents. Pointers themselves are skipped since fn sees the (addressable)
+// value they point to. Map values are copied so fn can modify them and then
+// put back.
+func walkValues(tag string, val reflect.Value, fn func(reflect.Value) error) error {
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() {
+			return nil
+		}
+
+		return walkValues(tag, val.Elem(), fn)
+	case reflect.Struct:
+		if isLeafStruct(val.Type()) {
+			break
+		}
+
+		typ := val.Type()
+		n := typ.NumField()
+		for i := 0; i < n; i++ {
+			field := typ.Field(i)
+			if _, _, ok := getTag(field, tag); !ok || len(field.PkgPath) != 0 {
+				// Untagged and unexported fields are left alone
+				continue
+			}
+
+			if err := walkValues(tag, val.Field(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := val.MapRange()
+		for iter.Next() {
+			elem := reflect.New(val.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := walkValues(tag, elem, fn); err != nil {
+				return err
+			}
+			val.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Slice:
+		for i := 0; i < val.Len(); i++ {
+			if err := walkValues(tag, val.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return fn(val)
+}
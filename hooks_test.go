@@ -0,0 +1,200 @@
+package loadcfg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type normHost struct {
+	Name string `toml:"name"`
+}
+
+func (n *normHost) Normalize() error {
+	if len(n.Name) == 0 {
+		return errors.New("name is required")
+	}
+
+	n.Name = strings.ToLower(n.Name)
+	return nil
+}
+
+type normConfig struct {
+	URL     string              `toml:"url"`
+	Host    normHost            `toml:"host"`
+	Mirrors map[string]normHost `toml:"mirrors"`
+	Backups []*normHost         `toml:"backups"`
+
+	// Set only once the nested host has been normalized
+	Summary string
+}
+
+func (n *normConfig) Normalize() error {
+	n.URL = strings.TrimRight(n.URL, "/")
+	n.Summary = n.Host.Name + " " + n.URL
+	return nil
+}
+
+func TestNormalize(t *testing.T) {
+	keys := setEnvs(
+		"TEST32_URL", "http://example.com//",
+		"TEST32_HOST_NAME", "EXAMPLE",
+		"TEST32_MIRRORS_ONE_NAME", "MIRROR",
+		"TEST32_BACKUPS_0_NAME", "BACKUP",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(normConfig)
+	if err := Env("test32", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.URL != "http://example.com" {
+		t.Error("url wrong:", got.URL)
+	}
+	if got.Host.Name != "example" {
+		t.Error("host wrong:", got.Host.Name)
+	}
+	if got.Mirrors["one"].Name != "mirror" {
+		t.Error("mirror wrong:", got.Mirrors["one"].Name)
+	}
+	if got.Backups[0].Name != "backup" {
+		t.Error("backup wrong:", got.Backups[0].Name)
+	}
+	if got.Summary != "example http://example.com" {
+		t.Error("nested values should be normalized first:", got.Summary)
+	}
+}
+
+func TestNormalizeError(t *testing.T) {
+	keys := setEnvs("TEST33_URL", "http://example.com")
+
+	defer unsetEnvs(keys)
+
+	if err := Env("test33", "toml", new(normConfig)); err == nil {
+		t.Error("expected the nested normalize error")
+	}
+}
+
+type validPort struct {
+	Port int `toml:"port"`
+}
+
+func (v validPort) Validate() error {
+	if v.Port < 1 || v.Port > 65535 {
+		return fmt.Errorf("port out of range: %d", v.Port)
+	}
+	return nil
+}
+
+type validConfig struct {
+	Name    string               `toml:"name"`
+	Server  validPort            `toml:"server"`
+	Admin   *validPort           `toml:"admin"`
+	Workers map[string]validPort `toml:"workers"`
+}
+
+func (v *validConfig) Validate() error {
+	if len(v.Name) == 0 {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	keys := setEnvs(
+		"TEST44_NAME", "app",
+		"TEST44_SERVER_PORT", "8080",
+		"TEST44_ADMIN_PORT", "9090",
+		"TEST44_WORKERS_ONE_PORT", "1",
+	)
+
+	defer unsetEnvs(keys)
+
+	if err := Env("test44", "toml", new(validConfig)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	keys := setEnvs(
+		"TEST45_SERVER_PORT", "70000",
+		"TEST45_ADMIN_PORT", "8080",
+		"TEST45_WORKERS_ONE_PORT", "0",
+	)
+
+	defer unsetEnvs(keys)
+
+	err := Env("test45", "toml", new(validConfig))
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	// Every invalid value is reported once
+	want := []string{"port out of range: 70000", "port out of range: 0", "name is required"}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("wrong number of errors, want: %d, got: %q", len(want), lines)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("missing error %q in: %v", w, err)
+		}
+	}
+}
+
+type tlsConfig struct {
+	TLSEnabled bool   `toml:"tls_enabled"`
+	Cert       string `toml:"tls_cert,required_if=tls_enabled:true"`
+
+	Client struct {
+		Mode string `toml:"mode"`
+	} `toml:"client"`
+	ClientCert string `toml:"client_cert,required_if=client.mode:verify"`
+}
+
+func TestRequiredIf(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		Env []string
+		Err string
+	}{
+		{Env: fakeEnvs()},
+		{Env: fakeEnvs("APP_TLS_ENABLED", "false")},
+		{Env: fakeEnvs("APP_TLS_ENABLED", "true", "APP_TLS_CERT", "cert.pem")},
+		{Env: fakeEnvs("APP_TLS_ENABLED", "true"), Err: "tls_cert is required when tls_enabled is true"},
+		{Env: fakeEnvs("APP_CLIENT_MODE", "none")},
+		{Env: fakeEnvs("APP_CLIENT_MODE", "verify", "APP_CLIENT_CERT", "client.pem")},
+		{Env: fakeEnvs("APP_CLIENT_MODE", "verify"), Err: "client_cert is required when client.mode is verify"},
+	}
+
+	for i, test := range tests {
+		l := Loader{Environ: test.Env}
+		err := l.Env("app", "toml", new(tlsConfig))
+		if len(test.Err) == 0 {
+			if err != nil {
+				t.Errorf("%d) unexpected error: %v", i, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, ErrRequired) || !strings.Contains(err.Error(), test.Err) {
+			t.Errorf("%d) want error %q, got: %v", i, test.Err, err)
+		}
+	}
+}
+
+func TestRequiredIfBadField(t *testing.T) {
+	t.Parallel()
+
+	obj := &struct {
+		Cert string `toml:"cert,required_if=missing:true"`
+	}{}
+
+	if err := Env("app", "toml", obj); !errors.Is(err, ErrFieldNotFound) {
+		t.Error("expected a field not found error:", err)
+	}
+}
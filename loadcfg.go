@@ -9,13 +9,21 @@
 //
 //    type A struct {
 //        // PREFIX_INT=5
-//        Int     int       `toml:"int"`
+//        Int     int           `toml:"int"`
 //        // PREFIX_INTPTR=5
-//        IntPtr  *int      `toml:"intptr"`
+//        IntPtr  *int          `toml:"intptr"`
 //        // PREFIX_STRINGS="one,two,three"
-//        Strings []string  `toml:"strings"`
+//        // PREFIX_STRINGS_1="two"
+//        // PREFIX_STRINGS="[]" (sets an empty slice)
+//        // PREFIX_STRINGS='"one,two",three' (quoted elements may hold commas)
+//        // PREFIX_STRINGS='["one", "two"]' (a TOML or JSON array)
+//        Strings []string      `toml:"strings"`
 //        // PREFIX_TIME=RFC3339TimeString
-//        Time    time.Time `toml:"time"`
+//        // PREFIX_TIME=2006-01-02 (or any other TOML local date/time)
+//        Time    time.Time     `toml:"time"`
+//        // PREFIX_TIMEOUT=5s
+//        // PREFIX_TIMEOUT=5000000000
+//        Timeout time.Duration `toml:"timeout"`
 //
 //        // PREFIX_MAP_KEYNAME_FLOAT=4.5
 //        Map        map[string]B    `toml:"map"`
@@ -28,6 +36,7 @@
 //
 //        // PREFIX_SLICE_0_FLOAT=4.5
 //        // PREFIX_SLICE_1_FLOAT=4.5
+//        // PREFIX_SLICE_+_FLOAT=4.5 (or _-1_, appends an element)
 //        Slice    []B  `toml:"slice"`
 //        // PREFIX_SLICEPTR_0_FLOAT=4.5
 //        SlicePtr []*B `toml:"sliceptr"`
@@ -43,81 +52,761 @@
 //    type B struct {
 //        Float float64 `toml:"float"`
 //    }
+//
+// The + and -1 indexes append every time they're loaded, so loading into the
+// same object again appends another element. Reload returns an error for them
+// since it starts from the object's current value.
+//
+// Map keys taken from env var names are lowercased, PREFIX_MAP_KeyName_FLOAT
+// sets the key "keyname". Use a Loader with PreserveWildcardCase to keep them
+// as they are.
+//
+// A map entry can be removed by setting it to __delete__, eg.
+// PREFIX_MAP_KEYNAME=__delete__ deletes "keyname" from a map the file filled
+// in. Loader.DeleteSentinel changes the value used.
+//
+// Struct tags can have options after the name which change how the field is
+// set from the env, eg. `toml:"name,filewins"`. Options on a map or slice
+// field apply to its elements as well:
+//
+//    filewins  do not set from env when the file already defined the key
+//    squash    the struct's fields are set as if they were in the parent, eg.
+//              `toml:",squash"` on an embedded struct, it's an error on
+//              named fields since the file wouldn't flatten them
+//    percent   floats may be given as a percentage, 50% is stored as 0.5
+//    secret    the value is never included in error messages
+//    negatable a bool can also be set with PREFIX_NO_NAME which negates the
+//              value, if both are set the NO_ form wins
+//    envalias  other env var names (after the prefix) that set the field when
+//              its own name isn't set, eg. `toml:"db,envalias=DB_URL|DSN"`,
+//              it's ignored on structs, maps and slices of them
+//    intbool   integers may also be given as true or false which are 1 and 0
+//    bytes     integers may be given as a byte size like 10MB or 1GiB, KB is
+//              1000 bytes and KiB is 1024
+//    key       a string field that names the struct when it's in a slice so
+//              elements can be found by name, eg. PREFIX_SERVERS_WEB_PORT
+//              sets the port of the element whose key field is "web" (or
+//              appends one), all digit names are still taken as indexes
+//    relative  times may also be given as now, now+1h or now-30m
+//    maxlen    the most elements a slice may have, indexes past it are an
+//              error, eg. `toml:"hosts,maxlen=10"`
+//    layout    times are parsed with this layout instead of RFC3339 and the
+//              TOML local forms, eg. `toml:"day,layout=2006-01-02"`, times
+//              without a zone are in time.Local. The time package's layouts
+//              can be used by name, eg. layout=RFC1123
+//    sep       lists are split on this instead of commas, and without
+//              quoting, eg. `toml:"hosts,sep=;"`. sep=newline splits on line
+//              endings for multi-line env values
+//    nosplit   a list is never split, the whole value is its only element,
+//              eg. for a connection string with commas in it
+//    required_if
+//              the field must be set (not the zero value) once loading is
+//              done when another field in the same struct has a value, eg.
+//              `toml:"tls_cert,required_if=tls_enabled:true"`, the other
+//              field may be nested like tls.enabled
+//    json      a struct can also be set all at once from a JSON object, eg.
+//              PREFIX_STRUCT={"float":4.5}, env vars for its fields still
+//              apply on top. It's decoded with encoding/json so json tags
+//              are used.
+//
+// A field's segment in env var names can differ from its key in the file with
+// the envseg tag, eg. `toml:"http_port" envseg:"port"` is set by PREFIX_PORT.
+//
+// A field can be kept out of the env entirely while still being read from the
+// file with the loadcfg:"-" tag.
 package loadcfg
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
 	"os"
+	"path"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/BurntSushi/toml"
 )
 
-var timeType = reflect.TypeOf(time.Time{})
+// defaultMaxSliceIndex is the largest slice index accepted from env when
+// Loader.MaxSliceIndex isn't set
+const defaultMaxSliceIndex = 10000
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	setterType   = reflect.TypeOf((*Setter)(nil)).Elem()
+)
+
+// These errors are wrapped by the errors returned from this package so they
+// can be checked with errors.Is.
+var (
+	// ErrFieldNotFound occurs when a key does not lead to any field
+	ErrFieldNotFound = errors.New("cannot set env, could not find struct field")
+	// ErrUnsettable occurs when a field cannot be set eg. it's unexported
+	ErrUnsettable = errors.New("cannot set")
+	// ErrParse occurs when a value cannot be parsed into a field's type
+	ErrParse = errors.New("parse error")
+	// ErrUnsupportedType occurs when a field's type cannot be set from env
+	ErrUnsupportedType = errors.New("type not supported")
+	// ErrIndexOutOfRange occurs when a slice index is not allowed
+	ErrIndexOutOfRange = errors.New("index out of range")
+	// ErrFrozen occurs when loading into an object that was frozen
+	ErrFrozen = errors.New("config is frozen")
+	// ErrRequired occurs when a field with required_if is not set even
+	// though its condition is met
+	ErrRequired = errors.New("required field not set")
+)
+
+// Setter can be implemented by a field's type to parse its own value from
+// an env var instead of using the built in parsing. Types implementing it are
+// always set as a whole, even if they are structs, maps or slices.
+type Setter interface {
+	LoadCfgSet(string) error
+}
+
+// Loader holds options that change how environment variables are matched
+// and applied. The zero value is ready to use and behaves exactly like the
+// package level functions.
+type Loader struct {
+	// IgnoreCase matches the prefix and keys against environment variables
+	// case-insensitively, so app_port matches as well as APP_PORT. By default
+	// only uppercase environment variables are matched.
+	IgnoreCase bool
+
+	// MapWildcard and SliceWildcard are the characters used in pseudo keys
+	// to stand in for a map key and a slice index respectively. They default
+	// to '*' and '#' and only need changing if a struct tag contains one of
+	// them.
+	MapWildcard   byte
+	SliceWildcard byte
+
+	// Separator is the character between the segments of env var names, eg.
+	// with '.' APP_SERVER.PORT sets server.port. It defaults to '_'.
+	// PrefixSeparator is what comes between the prefix and the rest of the
+	// name, it defaults to "_" as well, eg. with "__" APP__PORT sets port.
+	Separator       byte
+	PrefixSeparator string
+
+	// PreserveWildcardCase keeps map keys matched by a wildcard in the same
+	// case as they appear in the env var instead of lowercasing them.
+	PreserveWildcardCase bool
+
+	// SkipUnsettable skips fields that cannot be set (eg. unexported fields)
+	// instead of returning an error.
+	SkipUnsettable bool
+
+	// SkipMissingFields skips keys that lead to a field that doesn't exist
+	// instead of returning an error, eg. a stray key from an alias that only
+	// partly matches. Warn is still called with the reason.
+	SkipMissingFields bool
+
+	// UseFieldNameFallback gives exported fields without a struct tag a name
+	// for the env, their lowercased field name, instead of skipping them.
+	// Fields tagged "-" are still skipped.
+	UseFieldNameFallback bool
+
+	// SetterMethods sets fields that cannot be set directly (eg. unexported
+	// fields) by calling a method on the struct named Set followed by the
+	// field's name with its first letter uppercased, eg. SetValue for a field
+	// named value. The method must take a string and return nothing or an
+	// error.
+	SetterMethods bool
+
+	// Warn is called with the reason a value was skipped rather than set, it
+	// may be nil.
+	Warn func(err error)
+
+	// ValueTransforms are run in order on each env value before it's parsed,
+	// eg. to trim, lowercase or decrypt it. path is the key of the value
+	// being set, eg. []string{"db", "password"}, and must not be modified.
+	ValueTransforms []func(path []string, raw string) (string, error)
+
+	// Expand replaces ${VAR} and $VAR references in string values using
+	// ExpandMapping, or the env being loaded if it's nil. $$ becomes a
+	// literal $. Both env values and the strings decoded from the file are
+	// expanded. With EnvFirst, files decoded without TOML metadata (eg. by
+	// Load) aren't expanded since their strings can't be told apart from the
+	// env's.
+	Expand        bool
+	ExpandMapping func(name string) string
+
+	// OnlyChanges skips setting values that are equal to what's already in
+	// the object.
+	OnlyChanges bool
+
+	// OnChange is called with the key of each value that was set to
+	// something different than it was before, it may be nil.
+	OnChange func(key string)
+
+	// OnShadow is called with the key of each value from the env that
+	// overrides one the TOML file defined, which helps find env vars that
+	// quietly replace committed config. Values inside slices are never
+	// reported since the file's metadata has no indexes. It may be nil.
+	OnShadow func(key string)
+
+	// OnApply is called with the key, the current value and the new value
+	// right before each value from the env is set, whether it changes or
+	// not. The values are copies so they stay the same after the field is
+	// set. It may be nil.
+	OnApply func(key string, oldVal, newVal reflect.Value)
+
+	// ConfigFileEnv names an env var (without the prefix) that holds the path
+	// of the config file to load. If it's set to "CONFIG" and PREFIX_CONFIG
+	// is in the env then TOML loads that file instead of the one it was given.
+	ConfigFileEnv string
+
+	// DecimalComma accepts a comma as the decimal separator in floats, eg.
+	// 4,5 is 4.5. Lists are still split on commas first so a slice of floats
+	// can only use it for elements that are quoted, eg. "4,5","1,5", or with
+	// the sep option.
+	DecimalComma bool
+
+	// IntLiterals parses integers the same way as Go integer literals, so
+	// 0xFF, 0o17, 0b101 and 1_000_000 are all accepted. By default integers
+	// must be base 10.
+	IntLiterals bool
+
+	// FileEnvSuffix enables reading values from files, typically secrets
+	// mounted by Docker or Kubernetes. If it's "_FILE" then
+	// PREFIX_PASSWORD_FILE=/run/secrets/pw sets the password field to the
+	// trimmed contents of that file. If both PREFIX_PASSWORD and
+	// PREFIX_PASSWORD_FILE are set the plain value wins unless PreferFileEnv
+	// is set.
+	FileEnvSuffix string
+	PreferFileEnv bool
+
+	// AllowedKeys restricts the env vars that are read to exactly these names
+	// (including the prefix), any others are ignored. A nil list allows all
+	// env vars. The ConfigFileEnv var must be in the list as well for it to
+	// be used. Vars named in code rather than by the prefix, those read by
+	// Expand and PrefixFromEnv, aren't restricted.
+	AllowedKeys []string
+
+	// MaxSliceIndex is the largest slice index that is accepted, larger ones
+	// are an error rather than growing the slice to that size. This stops a
+	// single env var like PREFIX_SLICE_2000000000_FLOAT from exhausting
+	// memory. If it's 0 the default of 10000 is used, a negative value
+	// removes the limit.
+	MaxSliceIndex int
+
+	// StrictSliceIndex returns an error when an index would leave a gap in a
+	// slice, eg. setting index 5 of a slice of length 2. Indexes may still
+	// be equal to the length to append. This helps catch typos like
+	// PREFIX_SLICE_50_FLOAT.
+	StrictSliceIndex bool
+
+	// NameMapper builds the env var name (without the prefix) for a field
+	// from its path, eg. []string{"server", "port"}. It's only used for
+	// fields that aren't inside a map or slice, those are always matched
+	// using the default naming where segments are joined by underscores.
+	NameMapper func(path []string) string
+
+	// EnvFirst reverses the usual order so the environment overrides are
+	// applied before the file is decoded, meaning the file wins when both
+	// set the same value. The env then acts as a set of defaults for the
+	// file.
+	EnvFirst bool
+
+	// DeleteSentinel is the env value that deletes a map entry instead of
+	// setting it, eg. PREFIX_MAP_ONE=__delete__ removes the "one" key. If
+	// it's empty "__delete__" is used.
+	DeleteSentinel string
+
+	// NullSentinel is the env value that sets a pointer field to nil instead
+	// of parsing the value, eg. with "null" PREFIX_INTPTR=null clears a
+	// value the file set. Only pointers to scalars (not structs) can be
+	// nulled since only they are set by a single env var. It's off when
+	// empty.
+	NullSentinel string
+
+	// Environ replaces the process environment (os.Environ) as the source of
+	// env vars, each one in KEY=VALUE form.
+	Environ []string
+
+	// StrictFileKeys returns an error listing the keys in a TOML file that
+	// don't match any field, which catches typos in the file.
+	StrictFileKeys bool
+
+	// TrimQuotes is a set of quote characters that are stripped from the
+	// ends of values (or each element of a list) when the same one is at
+	// both ends, eg. with `"'` NAME='hello' is set to hello and PORT="8080"
+	// to 8080 but NAME='hello" is left as it is.
+	TrimQuotes string
+
+	// reloading is set by Reload to reject append tokens, which would
+	// append again on every reload
+	reloading bool
+}
+
+// WithValueTransform adds fn to the end of the Loader's ValueTransforms and
+// returns the Loader so calls can be chained.
+func (l *Loader) WithValueTransform(fn func(path []string, raw string) (string, error)) *Loader {
+	l.ValueTransforms = append(l.ValueTransforms, fn)
+	return l
+}
 
 // TOML loads filename using toml and deserializes it into obj, then
 // the environment overrides are applied. There is no error if a config file
 // is not found so you must check explicitly for this.
 func TOML(envPrefix, filename string, obj interface{}) (m toml.MetaData, err error) {
-	m, err = toml.DecodeFile(filename, obj)
-	if err != nil && !os.IsNotExist(err) {
-		return m, err
+	var l Loader
+	return l.TOML(envPrefix, filename, obj)
+}
+
+// Env deserializes environment variables into a struct. If envPrefix is
+// empty then env vars are matched against the struct tags directly, eg. PORT
+// instead of PREFIX_PORT. The structTag is configurable.
+//
+// obj must be a pointer to a struct, map or slice. Maps may also be passed by
+// value.
+func Env(envPrefix, structTag string, obj interface{}) error {
+	var l Loader
+	return l.Env(envPrefix, structTag, obj)
+}
+
+// EnvFromMap is the same as Env but the values come from env instead of the
+// process environment, eg. secrets fetched from a secrets manager. The keys
+// are the full env var names including the prefix.
+func EnvFromMap(env map[string]string, envPrefix, structTag string, obj interface{}) error {
+	var l Loader
+	return l.EnvFromMap(env, envPrefix, structTag, obj)
+}
+
+// TOML is the same as the package level TOML but uses the Loader's options.
+func (l *Loader) TOML(envPrefix, filename string, obj interface{}) (m toml.MetaData, err error) {
+	err = l.load(envPrefix, "toml", obj, func() (*toml.MetaData, error) {
+		m, err = toml.DecodeFile(l.configFile(envPrefix, filename), obj)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return &m, nil
+	})
+
+	return m, err
+}
+
+// PrefixFromEnv returns the value of the env var varName for use as an env
+// prefix, eg. when each tenant of a service has its own prefix.
+func PrefixFromEnv(varName string) string {
+	var l Loader
+	return l.PrefixFromEnv(varName)
+}
+
+// PrefixFromEnv is the same as the package level PrefixFromEnv but looks
+// in the Loader's Environ.
+func (l *Loader) PrefixFromEnv(varName string) string {
+	return l.getenv(varName)
+}
+
+// TOMLDynamicPrefix is the same as TOML except that the env prefix is read
+// from the env var prefixEnvVar when it's called. It's an error if that env
+// var isn't set, rather than loading unprefixed env vars.
+func TOMLDynamicPrefix(prefixEnvVar, filename string, obj interface{}) (toml.MetaData, error) {
+	var l Loader
+	return l.TOMLDynamicPrefix(prefixEnvVar, filename, obj)
+}
+
+// TOMLDynamicPrefix is the same as the package level TOMLDynamicPrefix but
+// uses the Loader's options.
+func (l *Loader) TOMLDynamicPrefix(prefixEnvVar, filename string, obj interface{}) (toml.MetaData, error) {
+	envPrefix := l.PrefixFromEnv(prefixEnvVar)
+	if len(envPrefix) == 0 {
+		return toml.MetaData{}, fmt.Errorf("env prefix variable %s is not set", prefixEnvVar)
+	}
+
+	return l.TOML(envPrefix, filename, obj)
+}
+
+// TOMLFS is the same as TOML but reads the file called name from fsys. There
+// is no error if the file does not exist in fsys.
+func TOMLFS(envPrefix string, fsys fs.FS, name string, obj interface{}) (toml.MetaData, error) {
+	var l Loader
+	return l.TOMLFS(envPrefix, fsys, name, obj)
+}
+
+// TOMLFS is the same as the package level TOMLFS but uses the Loader's
+// options.
+func (l *Loader) TOMLFS(envPrefix string, fsys fs.FS, name string, obj interface{}) (m toml.MetaData, err error) {
+	err = l.load(envPrefix, "toml", obj, func() (*toml.MetaData, error) {
+		f, err := fsys.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return &m, nil
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		m, err = toml.DecodeReader(f, obj)
+		if err != nil {
+			return nil, err
+		}
+		return &m, nil
+	})
+
+	return m, err
+}
+
+// TOMLSearch is the same as TOML but tries each of paths in order and loads
+// the first one that exists, returning the path that was used. If none of
+// them exist only the env is loaded and the path is empty.
+func TOMLSearch(envPrefix string, paths []string, obj interface{}) (toml.MetaData, string, error) {
+	var l Loader
+	return l.TOMLSearch(envPrefix, paths, obj)
+}
+
+// TOMLSearch is the same as the package level TOMLSearch but uses the
+// Loader's options. A file named by ConfigFileEnv is used instead of
+// searching.
+func (l *Loader) TOMLSearch(envPrefix string, paths []string, obj interface{}) (m toml.MetaData, used string, err error) {
+	if file := l.configFile(envPrefix, ""); len(file) != 0 {
+		paths = []string{file}
+	}
+
+	err = l.load(envPrefix, "toml", obj, func() (*toml.MetaData, error) {
+		for _, path := range paths {
+			m, err = toml.DecodeFile(path, obj)
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			used = path
+			break
+		}
+		return &m, nil
+	})
+
+	return m, used, err
+}
+
+// Load calls decode to deserialize a file of any format into obj and then
+// applies the environment overrides. As with TOML, if decode returns an error
+// that is fs.ErrNotExist it is ignored.
+func Load(envPrefix, structTag string, decode func(obj interface{}) error, obj interface{}) error {
+	var l Loader
+	return l.Load(envPrefix, structTag, decode, obj)
+}
+
+// Load is the same as the package level Load but uses the Loader's options.
+func (l *Loader) Load(envPrefix, structTag string, decode func(obj interface{}) error, obj interface{}) error {
+	return l.load(envPrefix, structTag, obj, func() (*toml.MetaData, error) {
+		if err := decode(obj); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
+
+// load runs decode and applies the environment overrides in the order set by
+// EnvFirst. decode returns the toml metadata if there is any.
+func (l *Loader) load(envPrefix, structTag string, obj interface{}, decode func() (*toml.MetaData, error)) error {
+	// Checked up front since decode writes to obj before the env is applied
+	if err := checkFrozen(obj); err != nil {
+		return err
 	}
 
-	env := os.Environ()
+	if !l.EnvFirst {
+		meta, err := decode()
+		if err != nil {
+			return err
+		}
+		if err = l.checkUndecoded(meta); err != nil {
+			return err
+		}
+		if l.Expand {
+			l.expandStrings(structTag, meta, nil, reflect.ValueOf(obj))
+		}
+
+		return l.env(envPrefix, structTag, meta, obj)
+	}
 
-	pseudoKeys, err := envPseudoKeys("toml", obj)
+	if err := l.overrides(l.environ(), envPrefix, structTag, "", nil, obj, nil); err != nil {
+		return err
+	}
+	meta, err := decode()
 	if err != nil {
-		return m, err
+		return err
 	}
+	if err = l.checkUndecoded(meta); err != nil {
+		return err
+	}
+	// Without metadata the env values can't be told apart from the file's
+	// and they've already been expanded
+	if l.Expand && meta != nil {
+		l.expandStrings(structTag, meta, nil, reflect.ValueOf(obj))
+	}
+
+	return finish(structTag, obj)
+}
 
-	kvs := findKeyValues(env, envPrefix, pseudoKeys)
-	if err = overwriteStructVals("toml", kvs, obj); err != nil {
-		return m, err
+// checkUndecoded returns an error listing the keys in the file that weren't
+// decoded into anything if StrictFileKeys is set
+func (l *Loader) checkUndecoded(meta *toml.MetaData) error {
+	if !l.StrictFileKeys || meta == nil {
+		return nil
 	}
 
-	return m, err
+	undecoded := meta.Undecoded()
+	if len(undecoded) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(undecoded))
+	for i, k := range undecoded {
+		keys[i] = k.String()
+	}
+
+	return fmt.Errorf("%w: unknown keys in file: %s", ErrFieldNotFound, strings.Join(keys, ", "))
 }
 
-// Env deserializes environment variables into a struct. The envPrefix is
-// not optional. The structTag is configurable.
-func Env(envPrefix, structTag string, obj interface{}) error {
-	env := os.Environ()
+// Env is the same as the package level Env but uses the Loader's options.
+func (l *Loader) Env(envPrefix, structTag string, obj interface{}) error {
+	return l.env(envPrefix, structTag, nil, obj)
+}
+
+// EnvFromMap is the same as the package level EnvFromMap but uses the
+// Loader's options.
+func (l *Loader) EnvFromMap(env map[string]string, envPrefix, structTag string, obj interface{}) error {
+	environ := make([]string, 0, len(env))
+	for k, v := range env {
+		environ = append(environ, k+"="+v)
+	}
+
+	// The map stands in for the whole env so references made by Expand are
+	// looked up in it as well
+	fromMap := *l
+	fromMap.Environ = environ
+	if err := fromMap.overrides(environ, envPrefix, structTag, "", nil, obj, nil); err != nil {
+		return err
+	}
+
+	return finish(structTag, obj)
+}
+
+// EnvSubset is the same as Env but only the env vars whose key matches
+// pattern are applied, eg. "db.*" to reload only the database config. The
+// pattern is matched with path.Match against the dot separated key, ie. the
+// struct tag names of the field and its parents with map keys and slice
+// indexes filled in. Since keys have no slashes a * matches across dots as
+// well, so "db.*" also matches "db.pool.size".
+func EnvSubset(envPrefix, structTag, pattern string, obj interface{}) error {
+	var l Loader
+	return l.EnvSubset(envPrefix, structTag, pattern, obj)
+}
+
+// EnvSubset is the same as the package level EnvSubset but uses the
+// Loader's options.
+func (l *Loader) EnvSubset(envPrefix, structTag, pattern string, obj interface{}) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad subset pattern %q: %w", pattern, err)
+	}
+
+	if err := l.overrides(l.environ(), envPrefix, structTag, pattern, nil, obj, nil); err != nil {
+		return err
+	}
+
+	return finish(structTag, obj)
+}
+
+// EnvResult describes what an env load found, similar to the MetaData
+// returned by TOML.
+type EnvResult struct {
+	// Applied has the value from the env for each key that was matched, eg.
+	// "map.one.float". Options like filewins and OnlyChanges may still have
+	// left some of them unchanged.
+	Applied map[string]string
+	// Unmatched are the names of env vars with the prefix that didn't match
+	// any field, which are often typos. It's always empty when there's no
+	// prefix.
+	Unmatched []string
+}
+
+// EnvWithResult is the same as Env but also returns what was loaded.
+func EnvWithResult(envPrefix, structTag string, obj interface{}) (EnvResult, error) {
+	var l Loader
+	return l.EnvWithResult(envPrefix, structTag, obj)
+}
 
-	pseudoKeys, err := envPseudoKeys("toml", obj)
+// EnvWithResult is the same as the package level EnvWithResult but uses the
+// Loader's options.
+func (l *Loader) EnvWithResult(envPrefix, structTag string, obj interface{}) (EnvResult, error) {
+	var res EnvResult
+	if err := l.overrides(l.environ(), envPrefix, structTag, "", nil, obj, &res); err != nil {
+		return res, err
+	}
+
+	return res, finish(structTag, obj)
+}
+
+// env applies the environment overrides to obj and then runs the hooks, meta
+// is the result of decoding a file into obj if there was one.
+func (l *Loader) env(envPrefix, structTag string, meta *toml.MetaData, obj interface{}) error {
+	if err := l.overrides(l.environ(), envPrefix, structTag, "", meta, obj, nil); err != nil {
+		return err
+	}
+
+	return finish(structTag, obj)
+}
+
+// overrides applies the overrides from environ (in KEY=VALUE form) to obj.
+// If pattern isn't empty only the keys it matches are applied. If res isn't
+// nil it's filled in with what was found.
+func (l *Loader) overrides(environ []string, envPrefix, structTag, pattern string, meta *toml.MetaData, obj interface{}, res *EnvResult) error {
+	env := l.allowedEnvs(environ)
+
+	pseudoKeys, err := l.envPseudoKeys(structTag, obj)
 	if err != nil {
 		return err
 	}
 
-	kvs := findKeyValues(env, envPrefix, pseudoKeys)
-	if err = overwriteStructVals("toml", kvs, obj); err != nil {
+	aliases := l.envAliases(structTag, nil, reflect.TypeOf(obj))
+	kvs := l.findKeyValues(env, envPrefix, pseudoKeys)
+	l.findDeleteValues(env, envPrefix, pseudoKeys, kvs)
+	l.findAliasValues(env, envPrefix, aliases, kvs)
+	if err = l.findFileValues(env, envPrefix, pseudoKeys, kvs); err != nil {
+		return err
+	}
+	if res != nil {
+		res.Unmatched = l.unmatchedEnvs(env, envPrefix, pseudoKeys, aliases)
+	}
+	if len(pattern) != 0 {
+		for k := range kvs {
+			// The pattern was checked by the caller so there's no error
+			if ok, _ := path.Match(pattern, k); !ok {
+				delete(kvs, k)
+			}
+		}
+	}
+
+	w := &overwriter{Loader: l, tag: structTag, meta: meta}
+	if err := w.overwriteStructVals(kvs, obj); err != nil {
 		return err
 	}
 
+	if res != nil {
+		res.Applied = kvs
+	}
 	return nil
 }
 
+// unmatchedEnvs returns the names of the env vars with the prefix that don't
+// set anything. With no prefix every env var has it so none are returned.
+func (l *Loader) unmatchedEnvs(envs []string, envPfx string, pseudoKeys []string, aliases map[string][]string) []string {
+	if len(envPfx) == 0 {
+		return nil
+	}
+
+	pfxUnderscore := l.prefixSep(envPfx)
+	configEnv := strings.ToUpper(pfxUnderscore + l.ConfigFileEnv)
+
+	var unmatched []string
+	for _, e := range envs {
+		name, val, ok := strings.Cut(e, "=")
+		if !ok || len(val) == 0 || !l.hasPrefix(name, pfxUnderscore) {
+			continue
+		}
+		if len(l.ConfigFileEnv) != 0 && name == configEnv {
+			continue
+		}
+
+		single := []string{e}
+		found := l.findKeyValues(single, envPfx, pseudoKeys)
+		l.findDeleteValues(single, envPfx, pseudoKeys, found)
+		l.findAliasValues(single, envPfx, aliases, found)
+		if suffix := l.FileEnvSuffix; len(found) == 0 && len(suffix) != 0 && len(name) > len(suffix) {
+			if keySuffix := name[len(name)-len(suffix):]; keySuffix == suffix || (l.IgnoreCase && strings.EqualFold(keySuffix, suffix)) {
+				found = l.findKeyValues([]string{name[:len(name)-len(suffix)] + "=" + val}, envPfx, pseudoKeys)
+			}
+		}
+
+		if len(found) == 0 {
+			unmatched = append(unmatched, name)
+		}
+	}
+
+	sort.Strings(unmatched)
+	return unmatched
+}
+
+// overwriter holds the state for a single pass of setting values into an
+// object.
+type overwriter struct {
+	*Loader
+
+	tag  string
+	meta *toml.MetaData
+
+	// key is the full key currently being set
+	key []string
+	// fileKey is key with segments renamed by envseg put back to the names
+	// used in the file, as far as the struct fields have been found
+	fileKey []string
+
+	// values are all the values being set in this pass
+	values map[string]string
+
+	// appended holds the index of the element appended (with the + or -1
+	// token) to each slice, keyed by the slice's path
+	appended map[string]int
+}
+
 // overwriteStructVals takes in struct tag paths to values to set
 // and an object to set them in
-func overwriteStructVals(tag string, values map[string]string, v interface{}) error {
+//
+// Slices grow to fit the largest index that is set and never shrink, any
+// indexes that are skipped over are left as zero values. Since the final
+// length only depends on the largest index the order the values are applied
+// in does not change the result.
+func (l *Loader) overwriteStructVals(tag string, values map[string]string, v interface{}) error {
+	w := &overwriter{Loader: l, tag: tag}
+	return w.overwriteStructVals(values, v)
+}
+
+func (w *overwriter) overwriteStructVals(values map[string]string, v interface{}) error {
+	if err := checkFrozen(v); err != nil {
+		return err
+	}
+
 	obj := reflect.ValueOf(v)
+	switch obj.Kind() {
+	case reflect.Ptr:
+		if obj.IsNil() {
+			return fmt.Errorf("%w: obj must be a non-nil pointer but got: %T", ErrUnsupportedType, v)
+		}
+	case reflect.Map:
+	case reflect.Slice:
+		// Slices need to be able to grow which requires a pointer
+		return fmt.Errorf("%w: slices must be passed by pointer but got: %T", ErrUnsupportedType, v)
+	default:
+		// Nothing can be set in a struct that was passed by value
+		return fmt.Errorf("%w: obj must be a pointer to struct/map/slice but got: %T", ErrUnsupportedType, v)
+	}
 
 	var keys []string
 	for k := range values {
 		keys = append(keys, k)
 	}
 
-	sort.Strings(keys)
+	sort.Slice(keys, func(i, j int) bool {
+		return lessKey(keys[i], keys[j])
+	})
 
+	w.values = values
 	for _, k := range keys {
-		keyParts := strings.Split(k, ".")
+		w.key = strings.Split(k, ".")
+		w.fileKey = append([]string(nil), w.key...)
 
-		if err := overwriteStructValsHelper(tag, keyParts, values[k], obj); err != nil {
+		if err := w.overwriteStructValsHelper(w.key, values[k], obj, nil); err != nil {
 			return err
 		}
 	}
@@ -125,40 +814,179 @@ func overwriteStructVals(tag string, values map[string]string, v interface{}) er
 	return nil
 }
 
-func overwriteStructValsHelper(tag string, key []string, val string, obj reflect.Value) error {
+// lessKey orders keys segment by segment. Segments are first put in a class:
+// numbers come first and are compared numerically (so slice.2 comes before
+// slice.10), then everything else compared lexically and last the append
+// tokens so they land past the end. Comparing the class first keeps the order
+// consistent for a mix like 10, 1a and 2.
+func lessKey(a, b string) bool {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		x, y := aParts[i], bParts[i]
+		if x == y {
+			continue
+		}
+
+		if xc, yc := segmentClass(x), segmentClass(y); xc != yc {
+			return xc < yc
+		}
+
+		if isDigits(x) && isDigits(y) {
+			// Compare by length first so that huge indexes can't overflow,
+			// equal numbers like 1 and 01 fall through to a lexical compare
+			xt, yt := strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(xt) != len(yt) {
+				return len(xt) < len(yt)
+			}
+			if xt != yt {
+				return xt < yt
+			}
+		}
+
+		return x < y
+	}
+
+	return len(aParts) < len(bParts)
+}
+
+// segmentClass puts a key segment in the order used by lessKey: numbers,
+// then names, then append tokens
+func segmentClass(s string) int {
+	switch {
+	case isDigits(s):
+		return 0
+	case isAppendToken(s):
+		return 2
+	}
+	return 1
+}
+
+// isAppendToken checks if a key segment appends to a slice
+func isAppendToken(s string) bool {
+	return s == "+" || s == "-1"
+}
+
+// isDigits checks that s is a non-empty string of ascii digits
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// overwriteStructValsHelper sets val at key inside obj, opts are the tag
+// options of the nearest struct field which are carried down through maps and
+// slices to the value being set.
+func (w *overwriter) overwriteStructValsHelper(key []string, val string, obj reflect.Value, opts tagOptions) error {
 	if obj.Kind() == reflect.Ptr {
 		obj = obj.Elem()
 	}
 
 	switch obj.Kind() {
 	case reflect.Struct:
-		if obj.Type() == timeType {
+		if isLeafStruct(obj.Type()) || (len(key) == 0 && opts.has("json")) {
 			// This is not the container we're looking for
 			break
 		}
+		if len(key) == 0 {
+			return fmt.Errorf("%w %s: a struct can't be set from a single value [%s]", ErrUnsupportedType, strings.Join(w.key, "."), obj.Type().String())
+		}
 
 		sType := obj.Type()
 		n := sType.NumField()
 		for i := 0; i < n; i++ {
 			field := sType.Field(i)
 
-			name, ok := getTag(field, tag)
+			name, opts, ok := w.envName(field, w.tag)
 			if !ok {
 				// We don't deal with missing or explicitly ignored struct tags
 				continue
 			}
 
-			if name != key[0] {
+			// Squashed fields don't have a segment of their own so look inside
+			// them for the key instead
+			squash := opts.has("squash")
+			negated := false
+			if squash {
+				if !w.hasField(w.tag, field.Type, key[0]) {
+					continue
+				}
+			} else if opts.has("negatable") && key[0] == "no_"+name {
+				negated = true
+			} else if name != key[0] {
 				// Keep searching
 				continue
 			}
 
+			if !negated && opts.has("negatable") && len(key) == 1 {
+				// The NO_ form wins when both are set, whichever way they
+				// happen to sort
+				negKey := cloneAndAppend(w.key[:len(w.key)-1], "no_"+name)
+				if _, ok := w.values[strings.Join(negKey, ".")]; ok {
+					return nil
+				}
+			}
+
+			if negated {
+				b, err := strconv.ParseBool(val)
+				if err != nil {
+					return fmt.Errorf("%s: %w: expected bool but got value: %s", strings.Join(w.key, "."), ErrParse, redact(val, opts))
+				}
+				val = strconv.FormatBool(!b)
+			}
+
+			if !squash {
+				// The file knows this segment by its tag name which may not
+				// be the env one (envseg, negatable)
+				fileName, _, _ := getTag(field, w.tag)
+				w.fileKey[len(w.key)-len(key)] = fileName
+			}
+
+			if opts.has("filewins") && w.meta != nil && w.meta.IsDefined(w.fileKey...) {
+				// The file already set this so the env is only a default
+				return nil
+			}
+
+			structFieldVal := obj.Field(i)
+			if !structFieldVal.CanSet() {
+				if w.SetterMethods && len(key) == 1 {
+					if set, ok := setterMethod(obj, field.Name); ok {
+						if err := set(val); err != nil {
+							return fmt.Errorf("%s: %w", strings.Join(w.key, "."), err)
+						}
+						return nil
+					}
+				}
+
+				err := fmt.Errorf("%w %s: %s (%s) [%s]", ErrUnsettable, strings.Join(w.key, "."), field.Name, name, structFieldVal.Type().String())
+				if w.SkipUnsettable {
+					w.warn(err)
+					return nil
+				}
+				return err
+			}
+
 			// If it's a map we have to create it since we're going to put
 			// a value inside it.
 			// If it's a pointer we have to create whatever's behind it.
-			structFieldVal := obj.Field(i)
 			switch field.Type.Kind() {
 			case reflect.Ptr:
+				// A squashed pointer isn't the leaf, its field with the
+				// same name is
+				if !squash && len(key) == 1 && len(w.NullSentinel) != 0 && val == w.NullSentinel {
+					if !structFieldVal.IsNil() && w.OnChange != nil {
+						w.OnChange(strings.Join(w.key, "."))
+					}
+					structFieldVal.Set(reflect.Zero(field.Type))
+					return nil
+				}
 				if structFieldVal.IsNil() {
 					ptrType := field.Type.Elem()
 					newVal := reflect.New(ptrType)
@@ -172,30 +1000,66 @@ func overwriteStructValsHelper(tag string, key []string, val string, obj reflect
 					structFieldVal.Set(newVal)
 				}
 			}
-			if !structFieldVal.CanSet() {
-				return fmt.Errorf("cannot set: %s (%s) [%s]", field.Name, name, structFieldVal.Type().String())
+			if squash {
+				return w.overwriteStructValsHelper(key, val, structFieldVal, opts)
 			}
-			return overwriteStructValsHelper(tag, key[1:], val, structFieldVal)
+			return w.overwriteStructValsHelper(key[1:], val, structFieldVal, opts)
 		}
 
-		return fmt.Errorf("cannot set env, could not find struct field: %s (%s)", key[0], val)
+		err := fmt.Errorf("%w %s: %s", ErrFieldNotFound, strings.Join(w.key, "."), key[0])
+		if w.SkipMissingFields {
+			w.warn(err)
+			return nil
+		}
+		return err
 	case reflect.Map:
+		// Maps that were freshly allocated in a container (eg. behind a new
+		// pointer) need to be made before anything is put in them
+		if obj.IsNil() {
+			if !obj.CanSet() {
+				return fmt.Errorf("%w %s: nil map [%s]", ErrUnsettable, strings.Join(w.key, "."), obj.Type().String())
+			}
+			obj.Set(reflect.MakeMap(obj.Type()))
+		}
+
+		if len(key) == 0 && isSetter(obj.Type()) {
+			break
+		} else if len(key) == 0 {
+			return fmt.Errorf("%w %s: a map can't be set from a single value [%s]", ErrUnsupportedType, strings.Join(w.key, "."), obj.Type().String())
+		}
+
 		// The current name is a map key
 		keyName := key[0]
 		// Let's see if we have an object in the map already
-		keyObj := reflect.ValueOf(keyName)
+		if obj.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%w %s: map keys must be strings [%s]", ErrUnsupportedType, strings.Join(w.key, "."), obj.Type().String())
+		}
+		// Named key types (type Key string) need the key converted to them
+		keyObj := reflect.ValueOf(keyName).Convert(obj.Type().Key())
 		valObj := obj.MapIndex(keyObj)
+
+		if len(key) == 1 && val == w.deleteSentinel() {
+			obj.SetMapIndex(keyObj, reflect.Value{})
+			if valObj.IsValid() && w.OnChange != nil {
+				w.OnChange(strings.Join(w.key, "."))
+			}
+			return nil
+		}
+
+		if obj.Type().Elem().Kind() == reflect.Interface && len(key) > 1 {
+			return w.setInterfaceMapVal(obj, keyObj, key, val, opts)
+		}
 		valType := obj.Type().Elem()
-		if !valObj.IsValid() {
-			// Key does not exist, we have to make a new whatever this is
-			// set it's value, then set it into our map
-			isValueTypePtr := valType.Kind() == reflect.Ptr
+		isValueTypePtr := valType.Kind() == reflect.Ptr
+		if !valObj.IsValid() || (isValueTypePtr && valObj.IsNil()) {
+			// Key does not exist (or is a nil pointer), we have to make a new
+			// whatever this is set it's value, then set it into our map
 			if isValueTypePtr {
 				valType = valType.Elem()
 			}
 
 			valObj = reflect.New(valType)
-			if err := overwriteStructValsHelper(tag, key[1:], val, valObj); err != nil {
+			if err := w.overwriteStructValsHelper(key[1:], val, valObj, opts); err != nil {
 				return err
 			}
 
@@ -206,11 +1070,11 @@ func overwriteStructValsHelper(tag string, key []string, val string, obj reflect
 			}
 			obj.SetMapIndex(keyObj, valObj)
 			return nil
-		} else if valType.Kind() == reflect.Ptr {
+		} else if isValueTypePtr {
 			// If this is the case we just need to set the values on this
 			// since it'll be addressable no problem and we don't have to reset
 			// in the map
-			return overwriteStructValsHelper(tag, key[1:], val, valObj)
+			return w.overwriteStructValsHelper(key[1:], val, valObj, opts)
 		} else {
 			// Here we have received a value type from the map itself
 			// so we set it and then overwrite the value in the map
@@ -224,7 +1088,7 @@ func overwriteStructValsHelper(tag string, key []string, val string, obj reflect
 				valObj = newObj
 			}
 
-			if err := overwriteStructValsHelper(tag, key[1:], val, valObj); err != nil {
+			if err := w.overwriteStructValsHelper(key[1:], val, valObj, opts); err != nil {
 				return err
 			}
 			obj.SetMapIndex(keyObj, valObj)
@@ -237,13 +1101,57 @@ func overwriteStructValsHelper(tag string, key []string, val string, obj reflect
 			break
 		}
 
-		index, err := strconv.Atoi(key[0])
-		if err != nil {
-			return fmt.Errorf("could not convert struct index to int: %s (%v)", key[0], err)
-		}
 		currentLength := obj.Len()
+		var index int
+		var newName string
+		if isAppendToken(key[0]) {
+			if w.reloading {
+				return fmt.Errorf("%w %s: appending to a slice can't be used with Reload since it would append again on every reload", ErrUnsupportedType, strings.Join(w.key, "."))
+			}
+
+			// Append a new element, every key in this pass that appends to
+			// the same slice shares the one new element
+			path := strings.Join(w.key[:len(w.key)-len(key)], ".")
+			appended, ok := w.appended[path]
+			if !ok {
+				appended = currentLength
+				if w.appended == nil {
+					w.appended = make(map[string]int)
+				}
+				w.appended[path] = appended
+			}
+			index = appended
+		} else if keyIndex, ok := keyField(w.tag, obj.Type().Elem()); ok && !isDigits(key[0]) {
+			// The element is named by its key field, find it or append a
+			// new one with that name
+			index = findKeyedElem(obj, keyIndex, key[0], !w.PreserveWildcardCase)
+			if index == currentLength {
+				newName = key[0]
+			}
+		} else {
+			var err error
+			index, err = strconv.Atoi(key[0])
+			if err != nil {
+				return fmt.Errorf("%w: could not convert struct index to int: %s (%v)", ErrParse, key[0], err)
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("%w: %s is a negative index", ErrIndexOutOfRange, strings.Join(w.key, "."))
+		}
+		if max := w.maxSliceIndex(); max >= 0 && index > max {
+			return fmt.Errorf("%w: %s is past the largest allowed index %d", ErrIndexOutOfRange, strings.Join(w.key, "."), max)
+		}
+		if max, ok, err := maxLen(opts); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(w.key, "."), err)
+		} else if ok && index >= max {
+			return fmt.Errorf("%w: %s is past the maxlen of %d", ErrIndexOutOfRange, strings.Join(w.key, "."), max)
+		}
+		if w.StrictSliceIndex && index > currentLength {
+			return fmt.Errorf("%w: %s skips past the end of the slice (length %d)", ErrIndexOutOfRange, strings.Join(w.key, "."), currentLength)
+		}
 		if index >= currentLength {
-			// We have to grow
+			// We have to grow, copying what's there and leaving any gap
+			// between the old length and index zeroed
 			newObj := reflect.MakeSlice(obj.Type(), index+1, index+1)
 			reflect.Copy(newObj, obj)
 			obj.Set(newObj)
@@ -262,23 +1170,75 @@ func overwriteStructValsHelper(tag string, key []string, val string, obj reflect
 				elem.Set(reflect.MakeMap(elemType))
 			}
 		}
-		return overwriteStructValsHelper(tag, key[1:], val, elem)
+		if len(newName) != 0 {
+			keyIndex, _ := keyField(w.tag, obj.Type().Elem())
+			reflect.Indirect(elem).Field(keyIndex).SetString(newName)
+		}
+		return w.overwriteStructValsHelper(key[1:], val, elem, opts)
 	}
 
 	if len(key) != 0 {
-		return fmt.Errorf("did not reach the end of key but found no container type: %#v (%s)", key, val)
+		err := fmt.Errorf("%w %s: did not reach the end of key but found no container type: %#v", ErrFieldNotFound, strings.Join(w.key, "."), key)
+		if w.SkipMissingFields {
+			w.warn(err)
+			return nil
+		}
+		return err
 	}
 
 	// We're not a container type
-	return setVal(obj, val)
-}
-
-// findKeyValues looks for values matching keys
-// The input value envs is typically going to be os.Environ
-func findKeyValues(envs []string, envPfx string, pseudoKeys []string) map[string]string {
-	kvs := make(map[string]string)
+	if w.OnShadow != nil && w.meta != nil && w.meta.IsDefined(w.fileKey...) {
+		w.OnShadow(strings.Join(w.key, "."))
+	}
 
-	pfxUnderscore := strings.ToUpper(envPfx) + "_"
+	for _, transform := range w.ValueTransforms {
+		var err error
+		if val, err = transform(w.key, val); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(w.key, "."), err)
+		}
+	}
+
+	if !w.OnlyChanges && w.OnChange == nil && w.OnApply == nil {
+		if err := w.setVal(obj, val, opts); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(w.key, "."), err)
+		}
+		return nil
+	}
+
+	// Set a copy so it can be compared to the current value, the old value
+	// is copied too since obj is about to be overwritten
+	oldObj := reflect.New(obj.Type()).Elem()
+	oldObj.Set(obj)
+	newObj := reflect.New(obj.Type()).Elem()
+	newObj.Set(obj)
+	if err := w.setVal(newObj, val, opts); err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(w.key, "."), err)
+	}
+
+	changed := !reflect.DeepEqual(oldObj.Interface(), newObj.Interface())
+	if !changed && w.OnlyChanges {
+		return nil
+	}
+
+	if w.OnApply != nil {
+		w.OnApply(strings.Join(w.key, "."), oldObj, newObj)
+	}
+	obj.Set(newObj)
+	if changed && w.OnChange != nil {
+		w.OnChange(strings.Join(w.key, "."))
+	}
+
+	return nil
+}
+
+// findKeyValues looks for values matching keys
+// The input value envs is typically going to be os.Environ
+func (l *Loader) findKeyValues(envs []string, envPfx string, pseudoKeys []string) map[string]string {
+	kvs := make(map[string]string)
+
+	// An empty prefix matches every env var, which is safe enough since only
+	// those which resolve to a pseudo key are returned
+	pfxUnderscore := l.prefixSep(envPfx)
 
 	for _, e := range envs {
 		envKV := strings.SplitN(e, "=", 2)
@@ -291,7 +1251,7 @@ func findKeyValues(envs []string, envPfx string, pseudoKeys []string) map[string
 			// No idea how this could happen, but check anyway
 			continue
 		}
-		if !strings.HasPrefix(envKey, pfxUnderscore) {
+		if !l.hasPrefix(envKey, pfxUnderscore) {
 			// No match here
 			continue
 		}
@@ -303,7 +1263,15 @@ func findKeyValues(envs []string, envPfx string, pseudoKeys []string) map[string
 		}
 
 		for _, pkey := range pseudoKeys {
-			found, ok := compareWildcardEnvs(envKey, pkey)
+			if l.NameMapper != nil && !l.hasWildcard(pkey) {
+				name := l.NameMapper(strings.Split(pkey, "."))
+				if envKey == name || (l.IgnoreCase && strings.EqualFold(envKey, name)) {
+					kvs[pkey] = envVal
+				}
+				continue
+			}
+
+			found, ok := l.compareWildcardEnvs(envKey, pkey)
 			if ok {
 				kvs[found] = envVal
 			}
@@ -313,24 +1281,261 @@ func findKeyValues(envs []string, envPfx string, pseudoKeys []string) map[string
 	return kvs
 }
 
+// findDeleteValues finds env vars that delete a whole map entry and puts them
+// into kvs. The pseudo keys only reach the values inside map entries that are
+// containers (eg. map.*.float) so the entry keys (map.*) are matched here, but
+// only when they hold the delete sentinel.
+func (l *Loader) findDeleteValues(envs []string, envPfx string, pseudoKeys []string, kvs map[string]string) {
+	mapWildcard, _ := l.wildcards()
+	sentinel := l.deleteSentinel()
+
+	var entryKeys []string
+	seen := make(map[string]bool)
+	for _, pkey := range pseudoKeys {
+		for i := 0; i < len(pkey); i++ {
+			if pkey[i] != mapWildcard || i+1 == len(pkey) {
+				continue
+			}
+
+			entryKey := pkey[:i+1]
+			if !seen[entryKey] {
+				seen[entryKey] = true
+				entryKeys = append(entryKeys, entryKey)
+			}
+		}
+	}
+
+	for k, v := range l.findKeyValues(envs, envPfx, entryKeys) {
+		if _, ok := kvs[k]; !ok && v == sentinel {
+			kvs[k] = v
+		}
+	}
+}
+
+// findFileValues finds env vars ending in FileEnvSuffix and puts the contents
+// of the files they name into kvs.
+func (l *Loader) findFileValues(envs []string, envPfx string, pseudoKeys []string, kvs map[string]string) error {
+	if len(l.FileEnvSuffix) == 0 {
+		return nil
+	}
+
+	// Strip the suffix so the rest can be matched like any other env var
+	var fileEnvs []string
+	for _, e := range envs {
+		envKV := strings.SplitN(e, "=", 2)
+		if len(envKV) <= 1 {
+			continue
+		}
+
+		envKey, suffix := envKV[0], l.FileEnvSuffix
+		if len(envKey) <= len(suffix) {
+			continue
+		}
+
+		keySuffix := envKey[len(envKey)-len(suffix):]
+		if keySuffix == suffix || (l.IgnoreCase && strings.EqualFold(keySuffix, suffix)) {
+			fileEnvs = append(fileEnvs, envKey[:len(envKey)-len(suffix)]+"="+envKV[1])
+		}
+	}
+
+	for key, filename := range l.findKeyValues(fileEnvs, envPfx, pseudoKeys) {
+		if _, ok := kvs[key]; ok && !l.PreferFileEnv {
+			continue
+		}
+
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read file for %s: %w", key, err)
+		}
+
+		kvs[key] = strings.TrimSpace(string(contents))
+	}
+
+	return nil
+}
+
+// allowedEnvs filters envs down to the AllowedKeys
+func (l *Loader) allowedEnvs(envs []string) []string {
+	if l.AllowedKeys == nil {
+		return envs
+	}
+
+	var allowed []string
+	for _, e := range envs {
+		if l.isAllowed(strings.SplitN(e, "=", 2)[0]) {
+			allowed = append(allowed, e)
+		}
+	}
+
+	return allowed
+}
+
+// isAllowed checks if the env var name is in AllowedKeys
+func (l *Loader) isAllowed(name string) bool {
+	if l.AllowedKeys == nil {
+		return true
+	}
+
+	for _, k := range l.AllowedKeys {
+		if name == k || (l.IgnoreCase && strings.EqualFold(name, k)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prefixUnderscore is the uppercased prefix and separator that env vars
+// start with, it's empty if there is no prefix.
+func prefixUnderscore(envPfx string) string {
+	var l Loader
+	return l.prefixSep(envPfx)
+}
+
+// prefixSep is the same as prefixUnderscore but uses the Loader's
+// PrefixSeparator.
+func (l *Loader) prefixSep(envPfx string) string {
+	if len(envPfx) == 0 {
+		return ""
+	}
+
+	sep := l.PrefixSeparator
+	if len(sep) == 0 {
+		sep = "_"
+	}
+	return strings.ToUpper(envPfx) + sep
+}
+
+// separator returns the byte between the segments of env var names
+func (l *Loader) separator() byte {
+	if l.Separator != 0 {
+		return l.Separator
+	}
+	return '_'
+}
+
+// findAliasValues adds the values of env vars named by envalias options
+// into kvs. A key that was already found by its own name is left alone,
+// otherwise the first alias that's set wins.
+func (l *Loader) findAliasValues(envs []string, envPfx string, aliases map[string][]string, kvs map[string]string) {
+	pfxUnderscore := l.prefixSep(envPfx)
+	for key, names := range aliases {
+		if _, ok := kvs[key]; ok {
+			continue
+		}
+
+	Names:
+		for _, name := range names {
+			for _, e := range envs {
+				envKV := strings.SplitN(e, "=", 2)
+				if len(envKV) <= 1 || len(envKV[1]) == 0 {
+					continue
+				}
+
+				if envKV[0] == pfxUnderscore+name || (l.IgnoreCase && strings.EqualFold(envKV[0], pfxUnderscore+name)) {
+					kvs[key] = envKV[1]
+					break Names
+				}
+			}
+		}
+	}
+}
+
+// envAliases finds the envalias options of all the fields reachable from
+// typ through structs, mapping the field's key to its aliases. Fields inside
+// maps and slices can't have aliases since their keys aren't known.
+func (l *Loader) envAliases(tag string, recurse []string, typ reflect.Type) map[string][]string {
+	aliases := make(map[string][]string)
+
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || isLeafStruct(typ) {
+		return aliases
+	}
+
+	n := typ.NumField()
+	for i := 0; i < n; i++ {
+		field := typ.Field(i)
+		name, opts, ok := l.envName(field, tag)
+		if !ok {
+			continue
+		}
+
+		newRecurse := cloneAndAppend(recurse, name)
+		if opts.has("squash") {
+			newRecurse = recurse
+		}
+
+		// Only fields set by a single value can have one from an alias,
+		// containers need the rest of a key to know what to set
+		if names, ok := opts.value("envalias"); ok && len(newRecurse) != 0 && isSingleValue(field.Type, opts) {
+			key := strings.Join(newRecurse, ".")
+			aliases[key] = strings.Split(names, "|")
+		}
+
+		for k, v := range l.envAliases(tag, newRecurse, field.Type) {
+			aliases[k] = v
+		}
+	}
+
+	return aliases
+}
+
+// isSingleValue checks if a field of type typ is set from a single env var
+// rather than from keys for its fields, entries or elements
+func isSingleValue(typ reflect.Type, opts tagOptions) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if isSetter(typ) {
+		return true
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		return isLeafStruct(typ) || opts.has("json")
+	case reflect.Map:
+		return false
+	case reflect.Slice:
+		elem := typ.Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		switch elem.Kind() {
+		case reflect.Struct:
+			return isLeafStruct(elem)
+		case reflect.Map, reflect.Slice:
+			return false
+		}
+	}
+
+	return true
+}
+
 // compareWildcardEnvs compares two strings with wildcards
-// it returns the matched string (letters found in a wildcard will be downcased)
-// whereas all other letters will be the same case as found in pkey
-func compareWildcardEnvs(env string, pkey string) (string, bool) {
+// it returns the matched string (letters found in a wildcard will be downcased
+// unless PreserveWildcardCase is set) whereas all other letters will be the
+// same case as found in pkey
+func (l *Loader) compareWildcardEnvs(env string, pkey string) (string, bool) {
 	var b strings.Builder
-	p := strings.ToUpper(pkey)
+	// Only ASCII is folded so that p stays byte for byte aligned with pkey,
+	// unicode case mappings can change the length of a string
+	p := asciiUpper(pkey)
 
 	// Char by char check that the inputs are the same
-	// _ can only match a _ or a .
-	// Everything matches * except _
+	// The separator (_ by default) can only match itself or a .
+	// Everything matches * except the separator
 	// [0-9] matches #
+	mapWildcard, sliceWildcard := l.wildcards()
+	sep := l.separator()
 	i, j := 0, 0
 	for {
 		if i >= len(env) || j >= len(p) {
 			break
 		}
 
-		if env[i] == p[j] || (env[i] == '_' && p[j] == '.') {
+		if l.foldByte(env[i]) == p[j] || (env[i] == sep && p[j] == '.') {
 			// Using the non-uppercase pkey here allows us to
 			// keep case sensitivity for pseudo keys for non wildcard entries
 			b.WriteByte(pkey[j])
@@ -340,19 +1545,25 @@ func compareWildcardEnvs(env string, pkey string) (string, bool) {
 		}
 
 		switch p[j] {
-		case '*':
-			if env[i] == '_' {
+		case mapWildcard:
+			if env[i] == sep {
 				j++
+			} else if l.PreserveWildcardCase {
+				b.WriteByte(env[i])
+				i++
 			} else {
-				b.WriteRune(unicode.ToLower(rune(env[i])))
+				b.WriteByte(asciiLower(env[i]))
 				i++
 			}
-		case '#':
-			if env[i] == '_' {
+		case sliceWildcard:
+			if env[i] == sep {
 				j++
 			} else if unicode.IsDigit(rune(env[i])) {
 				b.WriteByte(env[i])
 				i++
+			} else if n := appendToken(env, i, sep); n != 0 {
+				b.WriteString(env[i : i+n])
+				i += n
 			} else {
 				// Not a digit, not a _, this isn't a match
 				return "", false
@@ -366,8 +1577,11 @@ func compareWildcardEnvs(env string, pkey string) (string, bool) {
 
 	finishedEnvKey := i == len(env)
 	// If pseudo key ends in a * wildcard, we were on it, and env ran out
-	// we're also finished.
-	finishedPseudoKey := j == len(p) || (j == len(p)-1 && p[j] == '*')
+	// we're also finished. The same goes for a # wildcard as long as it
+	// managed to match a digit or the + append token.
+	finishedPseudoKey := j == len(p) ||
+		(j == len(p)-1 && p[j] == mapWildcard) ||
+		(j == len(p)-1 && p[j] == sliceWildcard && i > 0 && (unicode.IsDigit(rune(env[i-1])) || env[i-1] == '+'))
 
 	if finishedEnvKey && finishedPseudoKey {
 		return b.String(), true
@@ -376,10 +1590,251 @@ func compareWildcardEnvs(env string, pkey string) (string, bool) {
 	return "", false
 }
 
-func envPseudoKeys(tag string, obj interface{}) ([]string, error) {
+// appendToken returns the length of the slice append token (+ or -1) at
+// env[i] or 0 if there isn't one. The token must be a whole segment, sep is
+// what separates segments.
+func appendToken(env string, i int, sep byte) int {
+	if i > 0 && env[i-1] != sep {
+		return 0
+	}
+
+	for _, tok := range []string{"+", "-1"} {
+		if strings.HasPrefix(env[i:], tok) && (i+len(tok) == len(env) || env[i+len(tok)] == sep) {
+			return len(tok)
+		}
+	}
+
+	return 0
+}
+
+// configFile returns the filename from the ConfigFileEnv env var if there is
+// one, otherwise filename.
+func (l *Loader) configFile(envPrefix, filename string) string {
+	if len(l.ConfigFileEnv) == 0 {
+		return filename
+	}
+
+	name := strings.ToUpper(l.prefixSep(envPrefix) + l.ConfigFileEnv)
+	if !l.isAllowed(name) {
+		return filename
+	}
+
+	if path := l.getenv(name); len(path) != 0 {
+		return path
+	}
+
+	return filename
+}
+
+// trimQuotes strips a matching pair of TrimQuotes characters from the ends
+// of s
+func (l *Loader) trimQuotes(s string) string {
+	if len(s) < 2 || len(l.TrimQuotes) == 0 {
+		return s
+	}
+
+	if q := s[0]; q == s[len(s)-1] && strings.IndexByte(l.TrimQuotes, q) >= 0 {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// environ returns the env vars to load from
+func (l *Loader) environ() []string {
+	if l.Environ != nil {
+		return l.Environ
+	}
+	return os.Environ()
+}
+
+// getenv looks up a single env var in the env vars being loaded from
+func (l *Loader) getenv(name string) string {
+	if l.Environ == nil {
+		return os.Getenv(name)
+	}
+
+	for _, e := range l.Environ {
+		if k, v, ok := strings.Cut(e, "="); ok && k == name {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// maxSliceIndex returns the largest allowed slice index or -1 if there is no
+// limit
+func (l *Loader) maxSliceIndex() int {
+	switch {
+	case l.MaxSliceIndex == 0:
+		return defaultMaxSliceIndex
+	case l.MaxSliceIndex < 0:
+		return -1
+	}
+
+	return l.MaxSliceIndex
+}
+
+// intBase is the base used to parse integers
+func (l *Loader) intBase() int {
+	if l.IntLiterals {
+		return 0
+	}
+
+	return 10
+}
+
+// warn reports an error that did not stop the load
+func (l *Loader) warn(err error) {
+	if l.Warn != nil {
+		l.Warn(err)
+	}
+}
+
+// expand replaces variable references in s
+func (l *Loader) expand(s string) string {
+	mapping := l.ExpandMapping
+	if mapping == nil {
+		mapping = l.getenv
+	}
+
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return mapping(name)
+	})
+}
+
+// expandStrings expands the strings in val that came from the file. If
+// there's no metadata all of them are expanded, otherwise only the ones under
+// keys the file defined. path is the file's key for val.
+func (l *Loader) expandStrings(tag string, meta *toml.MetaData, path []string, val reflect.Value) {
+	switch val.Kind() {
+	case reflect.Ptr:
+		if !val.IsNil() {
+			l.expandStrings(tag, meta, path, val.Elem())
+		}
+	case reflect.Struct:
+		if isLeafStruct(val.Type()) {
+			return
+		}
+
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, opts, ok := getTag(field, tag)
+			if !ok || len(field.PkgPath) != 0 {
+				continue
+			}
+
+			fieldPath := path
+			if !opts.has("squash") {
+				fieldPath = cloneAndAppend(path, name)
+			}
+			l.expandStrings(tag, meta, fieldPath, val.Field(i))
+		}
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return
+		}
+
+		iter := val.MapRange()
+		for iter.Next() {
+			// Map values aren't addressable, expand a copy and put it back
+			elem := reflect.New(val.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			l.expandStrings(tag, meta, cloneAndAppend(path, iter.Key().String()), elem)
+			val.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Slice, reflect.Array:
+		// The metadata has no indexes so elements share the slice's key
+		for i := 0; i < val.Len(); i++ {
+			l.expandStrings(tag, meta, path, val.Index(i))
+		}
+	case reflect.String:
+		if val.CanSet() && (meta == nil || meta.IsDefined(path...)) {
+			val.SetString(l.expand(val.String()))
+		}
+	}
+}
+
+// hasPrefix checks that an env key begins with the uppercased prefix,
+// ignoring the case of the env key if the Loader is configured to.
+func (l *Loader) hasPrefix(envKey, prefix string) bool {
+	if !l.IgnoreCase {
+		return strings.HasPrefix(envKey, prefix)
+	}
+
+	return len(envKey) >= len(prefix) && strings.EqualFold(envKey[:len(prefix)], prefix)
+}
+
+// foldByte returns the byte of an env key that should be compared against
+// the uppercased pseudo key.
+func (l *Loader) foldByte(b byte) byte {
+	if l.IgnoreCase && 'a' <= b && b <= 'z' {
+		return b - 'a' + 'A'
+	}
+
+	return b
+}
+
+// asciiUpper uppercases the ASCII letters in s, leaving all other bytes
+// untouched
+func asciiUpper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'a' <= c && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+
+	return string(b)
+}
+
+// asciiLower lowercases b if it's an ASCII letter, bytes that are part of a
+// multi-byte character are left as they are so the character isn't broken
+func asciiLower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b - 'A' + 'a'
+	}
+
+	return b
+}
+
+// deleteSentinel returns the env value that deletes a map entry
+func (l *Loader) deleteSentinel() string {
+	if len(l.DeleteSentinel) != 0 {
+		return l.DeleteSentinel
+	}
+	return "__delete__"
+}
+
+// hasWildcard checks if a pseudo key contains a map or slice wildcard
+func (l *Loader) hasWildcard(pkey string) bool {
+	mapWildcard, sliceWildcard := l.wildcards()
+	return strings.IndexByte(pkey, mapWildcard) >= 0 || strings.IndexByte(pkey, sliceWildcard) >= 0
+}
+
+// wildcards returns the map and slice wildcard characters, using the
+// defaults for any that are not set.
+func (l *Loader) wildcards() (mapWildcard, sliceWildcard byte) {
+	mapWildcard, sliceWildcard = '*', '#'
+	if l.MapWildcard != 0 {
+		mapWildcard = l.MapWildcard
+	}
+	if l.SliceWildcard != 0 {
+		sliceWildcard = l.SliceWildcard
+	}
+
+	return mapWildcard, sliceWildcard
+}
+
+func (l *Loader) envPseudoKeys(tag string, obj interface{}) ([]string, error) {
 	typ := reflect.TypeOf(obj)
 
-	keys, err := envPseudoKeysHelper(tag, nil, typ)
+	keys, err := l.envPseudoKeysHelper(tag, nil, typ)
 	if err != nil {
 		return nil, err
 	}
@@ -387,33 +1842,54 @@ func envPseudoKeys(tag string, obj interface{}) ([]string, error) {
 	return keys, nil
 }
 
-func envPseudoKeysHelper(tag string, recurse []string, typ reflect.Type) ([]string, error) {
+func (l *Loader) envPseudoKeysHelper(tag string, recurse []string, typ reflect.Type) ([]string, error) {
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
 	}
 
+	// Setters are set as a whole even when they're maps or slices
+	if len(recurse) != 0 && isSetter(typ) {
+		return []string{strings.Join(recurse, ".")}, nil
+	}
+
 	switch typ.Kind() {
 	case reflect.Struct:
 		var keys []string
 
-		// If this is time type we don't recurse
-		if typ == timeType {
+		// If this is time type or a Setter we don't recurse
+		if isLeafStruct(typ) {
 			break
 		}
 
 		n := typ.NumField()
 		for i := 0; i < n; i++ {
 			field := typ.Field(i)
-			name, ok := getTag(field, tag)
+			name, opts, ok := l.envName(field, tag)
 			if !ok {
 				// We don't deal with missing or explicitly ignored struct tags
 				continue
 			}
 
 			newRecurse := cloneAndAppend(recurse, name)
+			if opts.has("squash") {
+				// The TOML decoder only flattens embedded structs without a
+				// name so anything else would be read from a different key
+				// in the file than in the env
+				if tagName, _, _ := getTag(field, tag); !field.Anonymous || len(tagName) != 0 {
+					return nil, fmt.Errorf("%w: squash on %s.%s, it can only be used on an embedded struct without a name", ErrUnsupportedType, typ.String(), field.Name)
+				}
+				newRecurse = recurse
+			}
 			fieldTyp := field.Type
 
-			newKeys, err := envPseudoKeysHelper(tag, newRecurse, fieldTyp)
+			if opts.has("negatable") {
+				keys = append(keys, strings.Join(cloneAndAppend(recurse, "no_"+name), "."))
+			}
+			if opts.has("json") && !opts.has("squash") && isStruct(fieldTyp) {
+				keys = append(keys, strings.Join(newRecurse, "."))
+			}
+
+			newKeys, err := l.envPseudoKeysHelper(tag, newRecurse, fieldTyp)
 			if err != nil {
 				return nil, err
 			}
@@ -423,9 +1899,13 @@ func envPseudoKeysHelper(tag string, recurse []string, typ reflect.Type) ([]stri
 
 		return keys, nil
 	case reflect.Map:
+		mapWildcard, _ := l.wildcards()
 		mapElemType := typ.Elem()
-		newRecurse := cloneAndAppend(recurse, "*")
-		return envPseudoKeysHelper(tag, newRecurse, mapElemType)
+		newRecurse := cloneAndAppend(recurse, string(mapWildcard))
+		if mapElemType.Kind() == reflect.Interface {
+			return l.interfacePseudoKeys(tag, newRecurse, mapElemType)
+		}
+		return l.envPseudoKeysHelper(tag, newRecurse, mapElemType)
 	case reflect.Slice:
 		// If we're a slice of a container type, recurse, else break
 		sliceElemType := typ.Elem()
@@ -435,100 +1915,698 @@ func envPseudoKeysHelper(tag string, recurse []string, typ reflect.Type) ([]stri
 			sliceElemKind = sliceElemType.Kind()
 		}
 
+		mapWildcard, sliceWildcard := l.wildcards()
 		switch sliceElemKind {
 		case reflect.Map, reflect.Struct, reflect.Slice:
-			newRecurse := cloneAndAppend(recurse, "#")
-			return envPseudoKeysHelper(tag, newRecurse, sliceElemType)
+			if isLeafStruct(sliceElemType) {
+				// Times and Setters are scalars
+				break
+			}
+
+			newRecurse := cloneAndAppend(recurse, string(sliceWildcard))
+			keys, err := l.envPseudoKeysHelper(tag, newRecurse, sliceElemType)
+			if err != nil {
+				return nil, err
+			}
+
+			// Elements with a key field can also be named like map entries
+			if _, ok := keyField(tag, sliceElemType); ok {
+				named, err := l.envPseudoKeysHelper(tag, cloneAndAppend(recurse, string(mapWildcard)), sliceElemType)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, named...)
+			}
+
+			return keys, nil
+		}
+
+		if len(recurse) != 0 {
+			// Scalar slices can be set as a whole list or element by element
+			key := strings.Join(recurse, ".")
+			return []string{key, key + "." + string(sliceWildcard)}, nil
 		}
 	}
 
 	if len(recurse) == 0 {
-		return nil, fmt.Errorf("top-level element must be struct/slice/map but got: %s", typ.String())
+		return nil, fmt.Errorf("%w: top-level element must be struct/slice/map but got: %s", ErrUnsupportedType, typ.String())
 	}
 
 	key := strings.Join(recurse, ".")
 	return []string{key}, nil
 }
 
-func getTag(field reflect.StructField, tag string) (string, bool) {
+// maxLen returns the maxlen tag option
+func maxLen(opts tagOptions) (int, bool, error) {
+	value, ok := opts.value("maxlen")
+	if !ok {
+		return 0, false, nil
+	}
+
+	max, err := strconv.Atoi(value)
+	if err != nil || max < 0 {
+		return 0, false, fmt.Errorf("%w: maxlen must be a non-negative int but got: %s", ErrParse, value)
+	}
+
+	return max, true, nil
+}
+
+// splitList splits a comma separated list. Elements may be double quoted
+// CSV style to contain commas, eg. "a,b",c is ["a,b" c]. When no element
+// starts with a quote it's a plain split, so quotes inside elements like
+// say "hi",bye are kept as they are.
+func splitList(s string) ([]string, error) {
+	if !strings.HasPrefix(s, `"`) && !strings.Contains(s, `,"`) {
+		return strings.Split(s, ","), nil
+	}
+
+	r := csv.NewReader(strings.NewReader(s))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	// A line ending outside of quotes would start another record, the sep
+	// option is for lists split across lines
+	if len(records) != 1 {
+		return nil, errors.New("quoted list has more than one line")
+	}
+
+	return records[0], nil
+}
+
+// splitSep splits a list on the sep tag option's separator. The separator
+// "newline" splits on line endings and ignores a trailing one.
+func splitSep(s, sep string) []string {
+	if sep != "newline" {
+		return strings.Split(s, sep)
+	}
+
+	s = strings.TrimRight(s, "\r\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// parseArray parses s as a TOML array of scalars like ["a", "b"] (which
+// includes JSON arrays) and returns the elements as strings to be parsed
+// again for the element type. It's not ok if s isn't in brackets or isn't a
+// valid array so it can be split as a plain list instead.
+func parseArray(s string) ([]string, bool) {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, false
+	}
+
+	var doc struct {
+		V []interface{} `toml:"v"`
+	}
+	if _, err := toml.Decode("v = "+s, &doc); err != nil {
+		return nil, false
+	}
+
+	elems := make([]string, len(doc.V))
+	for i, v := range doc.V {
+		switch v := v.(type) {
+		case string:
+			elems[i] = v
+		case time.Time:
+			elems[i] = v.Format(time.RFC3339Nano)
+		case int64, float64, bool:
+			elems[i] = fmt.Sprint(v)
+		default:
+			return nil, false
+		}
+	}
+
+	return elems, true
+}
+
+// tagOptions are the comma separated options that follow the name in a
+// struct tag.
+type tagOptions []string
+
+// has checks if the option is present
+func (t tagOptions) has(option string) bool {
+	for _, o := range t {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// value returns the value of a key=value option
+func (t tagOptions) value(key string) (string, bool) {
+	for _, o := range t {
+		if strings.HasPrefix(o, key+"=") {
+			return o[len(key)+1:], true
+		}
+	}
+
+	return "", false
+}
+
+func getTag(field reflect.StructField, tag string) (string, tagOptions, bool) {
 	structTag := field.Tag.Get(tag)
 
 	if len(structTag) == 0 {
-		return "", false
+		return "", nil, false
 	}
 
 	tagParts := strings.Split(structTag, ",")
-	name := tagParts[0]
-	// We don't deal with unnamed objects in a struct
-	if len(name) == 0 || name == "-" {
-		return "", false
+	name, opts := tagParts[0], tagOptions(tagParts[1:])
+	// We don't deal with unnamed objects in a struct unless they're squashed
+	// into their parent
+	if name == "-" || (len(name) == 0 && !opts.has("squash")) {
+		return "", nil, false
+	}
+
+	return name, opts, true
+}
+
+// envTag is the same as getTag but the name is the one used for env vars,
+// which is the envseg tag if the field has one. Fields tagged loadcfg:"-"
+// are never set from env.
+func envTag(field reflect.StructField, tag string) (string, tagOptions, bool) {
+	if field.Tag.Get("loadcfg") == "-" {
+		return "", nil, false
+	}
+
+	name, opts, ok := getTag(field, tag)
+	if !ok || len(name) == 0 {
+		return name, opts, ok
+	}
+
+	if seg := field.Tag.Get("envseg"); len(seg) != 0 {
+		name = seg
+	}
+
+	return name, opts, true
+}
+
+// envName is the same as envTag but also gives untagged fields a name when
+// UseFieldNameFallback is set
+func (l *Loader) envName(field reflect.StructField, tag string) (string, tagOptions, bool) {
+	if _, tagged := field.Tag.Lookup(tag); !tagged && l.UseFieldNameFallback &&
+		len(field.PkgPath) == 0 && field.Tag.Get("loadcfg") != "-" {
+		return strings.ToLower(field.Name), nil, true
+	}
+
+	return envTag(field, tag)
+}
+
+// hasField checks if a struct type has a field called name, looking inside
+// squashed fields as well.
+func (l *Loader) hasField(tag string, typ reflect.Type, name string) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || isLeafStruct(typ) {
+		return false
+	}
+
+	n := typ.NumField()
+	for i := 0; i < n; i++ {
+		fieldName, opts, ok := l.envName(typ.Field(i), tag)
+		if !ok {
+			continue
+		}
+
+		if opts.has("squash") {
+			if l.hasField(tag, typ.Field(i).Type, name) {
+				return true
+			}
+		} else if fieldName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyField finds the index of the string field tagged with the key option in
+// a struct (or pointer to struct) type. Slices of these structs can have their
+// elements addressed by that field's value instead of an index.
+func keyField(tag string, typ reflect.Type) (int, bool) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || isLeafStruct(typ) {
+		return 0, false
+	}
+
+	n := typ.NumField()
+	for i := 0; i < n; i++ {
+		field := typ.Field(i)
+		_, opts, ok := getTag(field, tag)
+		if ok && opts.has("key") && field.Type.Kind() == reflect.String {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// findKeyedElem returns the index of the element in slice whose key field is
+// name, or the slice's length if there is none.
+func findKeyedElem(slice reflect.Value, keyIndex int, name string, fold bool) int {
+	for i := 0; i < slice.Len(); i++ {
+		elem := reflect.Indirect(slice.Index(i))
+		if !elem.IsValid() {
+			continue
+		}
+
+		if s := elem.Field(keyIndex).String(); s == name || (fold && strings.EqualFold(s, name)) {
+			return i
+		}
+	}
+
+	return slice.Len()
+}
+
+// setterMethod finds the Set<FieldName> method of the struct obj, see
+// Loader.SetterMethods
+func setterMethod(obj reflect.Value, fieldName string) (func(string) error, bool) {
+	if !obj.CanAddr() || len(fieldName) == 0 {
+		return nil, false
+	}
+
+	r, size := utf8.DecodeRuneInString(fieldName)
+	name := "Set" + string(unicode.ToUpper(r)) + fieldName[size:]
+	method := obj.Addr().MethodByName(name)
+	if !method.IsValid() {
+		return nil, false
+	}
+
+	switch fn := method.Interface().(type) {
+	case func(string):
+		return func(s string) error { fn(s); return nil }, true
+	case func(string) error:
+		return fn, true
+	}
+
+	return nil, false
+}
+
+// isStruct checks if typ is a struct (or pointer to one) that has its fields
+// set individually
+func isStruct(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && !isLeafStruct(typ)
+}
+
+// isLeafStruct checks if a struct type should be set from a single value
+// rather than having each of it's fields set individually.
+func isLeafStruct(typ reflect.Type) bool {
+	if _, ok := embeddedTime(typ); ok {
+		return true
+	}
+	return typ == timeType || isSetter(typ)
+}
+
+// isSetter checks if typ (or a pointer to it) implements Setter, whatever
+// kind it is
+func isSetter(typ reflect.Type) bool {
+	return typ.Implements(setterType) || reflect.PtrTo(typ).Implements(setterType)
+}
+
+// embeddedTime returns the index of the time.Time embedded in typ, wrappers
+// like struct{ time.Time } are set as times
+func embeddedTime(typ reflect.Type) (int, bool) {
+	if typ.Kind() != reflect.Struct {
+		return 0, false
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		if field := typ.Field(i); field.Anonymous && field.Type == timeType {
+			return i, true
+		}
 	}
 
-	return name, true
+	return 0, false
 }
 
-func setVal(val reflect.Value, envVal string) error {
+// setterOf returns the Setter implementation for val if there is one
+func setterOf(val reflect.Value) (Setter, bool) {
+	if val.CanAddr() {
+		if s, ok := val.Addr().Interface().(Setter); ok {
+			return s, true
+		}
+	}
+	if val.CanInterface() {
+		if s, ok := val.Interface().(Setter); ok {
+			return s, true
+		}
+	}
+
+	return nil, false
+}
+
+func (w *overwriter) setVal(val reflect.Value, envVal string, opts tagOptions) error {
+	if val.Kind() != reflect.Slice {
+		// Slices are trimmed element by element instead
+		envVal = w.trimQuotes(envVal)
+	}
+
+	if s, ok := setterOf(val); ok {
+		return s.LoadCfgSet(envVal)
+	}
+
+	if opts.has("json") && val.Kind() == reflect.Struct && val.CanAddr() {
+		if err := json.Unmarshal([]byte(envVal), val.Addr().Interface()); err != nil {
+			return fmt.Errorf("%w: expected json object but got value: %s", ErrParse, redact(envVal, opts))
+		}
+		return nil
+	}
+
 	switch val.Kind() {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		i, err := strconv.ParseUint(envVal, 10, 64)
+		if opts.has("bytes") {
+			n, err := parseBytes(envVal)
+			if err != nil {
+				return fmt.Errorf("%w: expected byte size but got value: %s", ErrParse, redact(envVal, opts))
+			}
+			if val.OverflowUint(n) {
+				return fmt.Errorf("%w: byte size out of range for %s: %s", ErrParse, val.Type().String(), redact(envVal, opts))
+			}
+			val.SetUint(n)
+			break
+		}
+
+		if opts.has("intbool") {
+			if strings.EqualFold(envVal, "true") {
+				val.SetUint(1)
+				break
+			} else if strings.EqualFold(envVal, "false") {
+				val.SetUint(0)
+				break
+			}
+		}
+
+		i, err := strconv.ParseUint(envVal, w.intBase(), 64)
 		if err != nil {
-			return fmt.Errorf("expected uint but got value: %q", envVal)
+			return fmt.Errorf("%w: expected uint but got value: %s", ErrParse, redact(envVal, opts))
 		}
 
 		val.SetUint(i)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		i, err := strconv.ParseInt(envVal, 10, 64)
+		if opts.has("bytes") {
+			n, err := parseBytes(envVal)
+			if err != nil {
+				return fmt.Errorf("%w: expected byte size but got value: %s", ErrParse, redact(envVal, opts))
+			}
+			if n > math.MaxInt64 || val.OverflowInt(int64(n)) {
+				return fmt.Errorf("%w: byte size out of range for %s: %s", ErrParse, val.Type().String(), redact(envVal, opts))
+			}
+			val.SetInt(int64(n))
+			break
+		}
+
+		if opts.has("intbool") {
+			if strings.EqualFold(envVal, "true") {
+				val.SetInt(1)
+				break
+			} else if strings.EqualFold(envVal, "false") {
+				val.SetInt(0)
+				break
+			}
+		}
+
+		isDuration := val.Type() == durationType
+		if isDuration {
+			if d, err := time.ParseDuration(envVal); err == nil {
+				val.SetInt(int64(d))
+				break
+			}
+		}
+
+		// Durations without units fall through to here and are nanoseconds
+		i, err := strconv.ParseInt(envVal, w.intBase(), 64)
 		if err != nil {
-			return fmt.Errorf("expected int but got value: %q", envVal)
+			if isDuration {
+				return fmt.Errorf("%w: expected duration but got value: %s", ErrParse, redact(envVal, opts))
+			}
+			return fmt.Errorf("%w: expected int but got value: %s", ErrParse, redact(envVal, opts))
 		}
 
 		val.SetInt(i)
 	case reflect.Bool:
 		b, err := strconv.ParseBool(envVal)
 		if err != nil {
-			return fmt.Errorf("expected bool but got value: %q", envVal)
+			return fmt.Errorf("%w: expected bool but got value: %s", ErrParse, redact(envVal, opts))
 		}
 
 		val.SetBool(b)
 	case reflect.String:
+		if w.Expand {
+			envVal = w.expand(envVal)
+		}
+
 		val.SetString(envVal)
-	case reflect.Float64:
-		i, err := strconv.ParseFloat(envVal, 64)
-		if err != nil {
-			return fmt.Errorf("expected float but got value: %q", envVal)
+	case reflect.Float32, reflect.Float64:
+		percent := opts.has("percent") && strings.HasSuffix(envVal, "%")
+		if percent {
+			envVal = envVal[:len(envVal)-1]
+		}
+		if w.DecimalComma && strings.Count(envVal, ",") == 1 && !strings.Contains(envVal, ".") {
+			envVal = strings.Replace(envVal, ",", ".", 1)
+		}
+
+		// Parsing at the field's size makes values a float32 can't hold a
+		// range error instead of quietly becoming infinite
+		i, err := strconv.ParseFloat(envVal, val.Type().Bits())
+		if errors.Is(err, strconv.ErrRange) {
+			return fmt.Errorf("%w: float out of range for %s: %s", ErrParse, val.Type().String(), redact(envVal, opts))
+		} else if err != nil {
+			return fmt.Errorf("%w: expected float but got value: %s", ErrParse, redact(envVal, opts))
+		}
+
+		if percent {
+			i /= 100
 		}
 
 		val.SetFloat(i)
 	case reflect.Slice:
-		elemType := val.Type().Elem()
+		// [] clears the slice, env vars can't be empty so this is the only
+		// way to express it
+		if envVal == "[]" {
+			val.Set(reflect.MakeSlice(val.Type(), 0, 0))
+			break
+		}
 
-		// For each element, append a zero value of it, then try to set it
-		// with the corresponding string value in the env var
-		splits := strings.Split(envVal, ",")
+		// Make a new slice and set each element with the corresponding string
+		// value in the env var, the whole list replaces anything that was
+		// there before
+		var splits []string
+		if opts.has("nosplit") {
+			splits = []string{envVal}
+		} else if sep, ok := opts.value("sep"); ok && len(sep) != 0 {
+			splits = splitSep(envVal, sep)
+		} else if splits, ok = parseArray(envVal); !ok {
+			var err error
+			if splits, err = splitList(envVal); err != nil {
+				return fmt.Errorf("%w: malformed list: %s", ErrParse, redact(envVal, opts))
+			}
+		}
+		if max, ok, err := maxLen(opts); err != nil {
+			return err
+		} else if ok && len(splits) > max {
+			return fmt.Errorf("%w: %d elements is more than the maxlen of %d", ErrIndexOutOfRange, len(splits), max)
+		}
+		newSlice := reflect.MakeSlice(val.Type(), len(splits), len(splits))
 		for i, s := range splits {
-			zero := reflect.Zero(elemType)
-			val.Set(reflect.Append(val, zero))
-
-			element := val.Index(i)
-			if err := setVal(element, s); err != nil {
+			if err := w.setVal(newSlice.Index(i), s, opts); err != nil {
 				return err
 			}
 		}
+
+		val.Set(newSlice)
 	case reflect.Struct:
-		// This should be a time struct
-		t, err := time.Parse(time.RFC3339, envVal)
+		// This should be a time struct or a wrapper around one
+		if i, ok := embeddedTime(val.Type()); ok {
+			val = val.Field(i)
+		}
+
+		if opts.has("relative") {
+			if t, ok := parseRelativeTime(envVal, time.Now()); ok {
+				val.Set(reflect.ValueOf(t))
+				break
+			}
+		}
+
+		if layout, ok := opts.value("layout"); ok {
+			layout, err := timeLayout(layout)
+			if err != nil {
+				return err
+			}
+
+			t, err := time.ParseInLocation(layout, envVal, time.Local)
+			if err != nil {
+				return fmt.Errorf("%w: expected time in layout %s but got value: %s", ErrParse, layout, redact(envVal, opts))
+			}
+
+			val.Set(reflect.ValueOf(t))
+			break
+		}
+
+		t, err := parseTime(envVal)
 		if err != nil {
-			return fmt.Errorf("expected time but got value: %q", envVal)
+			return fmt.Errorf("%w: expected time but got value: %s", ErrParse, redact(envVal, opts))
 		}
 
 		val.Set(reflect.ValueOf(t))
 	default:
-		return fmt.Errorf("type %s not supported", val.Type().String())
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, val.Type().String())
 	}
 
 	return nil
 }
 
+// redact quotes a value for an error message unless it's a secret
+func redact(val string, opts tagOptions) string {
+	if opts.has("secret") {
+		return `"***"`
+	}
+
+	return strconv.Quote(val)
+}
+
+// localTimeLayouts are the TOML local date and time forms which have no
+// offset, they are parsed in the local time zone
+var localTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"15:04:05",
+}
+
+// byteUnits are the multipliers for the byte size suffixes, decimal units
+// are powers of 1000 and binary units powers of 1024
+var byteUnits = map[string]uint64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// parseBytes parses a human byte size like 10MB or 1GiB into a number of
+// bytes, a plain number is taken as bytes.
+func parseBytes(s string) (uint64, error) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	n, err := strconv.ParseUint(s[:i], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown byte size unit: %s", s[i:])
+	}
+	if n > math.MaxUint64/unit {
+		return 0, fmt.Errorf("byte size overflows: %s", s)
+	}
+
+	return n * unit, nil
+}
+
+// parseTime parses an RFC3339 time falling back to the TOML local date and
+// time forms
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+
+	for _, layout := range localTimeLayouts {
+		if local, localErr := time.ParseInLocation(layout, s, time.Local); localErr == nil {
+			return local, nil
+		}
+	}
+
+	return t, err
+}
+
+// timeLayouts are the names of the time package's layouts that can be used
+// in the layout tag option
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// timeLayout resolves the layout tag option which is either the name of one
+// of the time package's layouts or a layout itself. Anything that looks like
+// a name (a letter followed by letters and digits) must be a known one.
+func timeLayout(layout string) (string, error) {
+	if named, ok := timeLayouts[layout]; ok {
+		return named, nil
+	}
+
+	isName := len(layout) != 0 && unicode.IsLetter(rune(layout[0]))
+	for i := 0; i < len(layout) && isName; i++ {
+		c := rune(layout[i])
+		isName = unicode.IsLetter(c) || unicode.IsDigit(c)
+	}
+	if isName {
+		return "", fmt.Errorf("%w: unknown time layout name: %s", ErrUnsupportedType, layout)
+	}
+
+	return layout, nil
+}
+
+// parseRelativeTime parses now, now+2h or now-30m against now. ok is false
+// if s isn't in that form.
+func parseRelativeTime(s string, now time.Time) (time.Time, bool) {
+	if len(s) < 3 || !strings.EqualFold(s[:3], "now") {
+		return time.Time{}, false
+	}
+
+	rest := s[3:]
+	if len(rest) == 0 {
+		return now, true
+	}
+	if rest[0] != '+' && rest[0] != '-' {
+		return time.Time{}, false
+	}
+
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return now.Add(d), true
+}
+
 func cloneAndAppend(list []string, item string) []string {
 	if len(list) == 0 {
 		return []string{item}
@@ -1,10 +1,18 @@
 package loadcfg
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -135,6 +143,441 @@ func TestTOMLWithOverride(t *testing.T) {
 	}
 }
 
+func TestTOMLDeleteMapEntry(t *testing.T) {
+	got := new(A)
+
+	keys := setEnvs(
+		"TEST41_MAP_TWO", "__delete__",
+		"TEST41_MAPPTR_ONE", "__delete__",
+		"TEST41_MAPPRIM_TWO", "__delete__",
+		"TEST41_MAPPRIM_MISSING", "__delete__",
+	)
+
+	defer unsetEnvs(keys)
+
+	if _, err := TOML("test41", "testdata/one.toml", got); err != nil {
+		t.Error(err)
+	}
+
+	if _, ok := got.Map["two"]; ok || len(got.Map) != 1 {
+		t.Error("map two should be deleted:", got.Map)
+	}
+	if _, ok := got.MapPtr["one"]; ok || len(got.MapPtr) != 1 {
+		t.Error("mapptr one should be deleted:", got.MapPtr)
+	}
+	if want := map[string]int{"one": 1}; !reflect.DeepEqual(want, got.MapPrim) {
+		t.Errorf("mapprim wrong, want: %v, got: %v", want, got.MapPrim)
+	}
+
+	// The sentinel is configurable and the default is then a normal value
+	defer unsetEnvs(setEnvs(
+		"TEST42_MAP_ONE", "__delete__",
+		"TEST42_MAPPRIMPTR_ONE", "-",
+	))
+
+	got = new(A)
+	l := Loader{DeleteSentinel: "-"}
+	if _, err := l.TOML("test42", "testdata/one.toml", got); err != nil {
+		t.Error(err)
+	}
+	if _, ok := got.MapPrimPtr["one"]; ok {
+		t.Error("mapprimptr one should be deleted:", got.MapPrimPtr)
+	}
+	if len(got.Map) != 2 {
+		t.Error("map entries should not be deleted:", got.Map)
+	}
+}
+
+func TestTOMLEnvSeg(t *testing.T) {
+	type Seg struct {
+		HTTPPort int    `toml:"http_port" envseg:"port"`
+		DBHost   string `toml:"db_host,filewins" envseg:"host"`
+		Nested   struct {
+			Name string `toml:"full_name" envseg:"name"`
+		} `toml:"nested_struct" envseg:"nested"`
+	}
+
+	keys := setEnvs(
+		"TEST52_PORT", "9090",
+		"TEST52_HTTP_PORT", "1",
+		"TEST52_HOST", "env",
+		"TEST52_NESTED_NAME", "seg",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Seg)
+	if _, err := TOML("test52", "testdata/envseg.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.HTTPPort != 9090 {
+		t.Error("http port wrong:", got.HTTPPort)
+	}
+	// filewins looks up the file key, not the env segment
+	if got.DBHost != "file" {
+		t.Error("db host wrong:", got.DBHost)
+	}
+	if got.Nested.Name != "seg" {
+		t.Error("nested name wrong:", got.Nested.Name)
+	}
+}
+
+func TestTOMLSearch(t *testing.T) {
+	keys := setEnvs("TEST57_MAPPRIM_ONE", "2")
+
+	defer unsetEnvs(keys)
+
+	paths := []string{"testdata/missing.toml", "testdata/one.toml", "testdata/filewins.toml"}
+
+	got := new(A)
+	_, used, err := TOMLSearch("test57", paths, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if used != "testdata/one.toml" {
+		t.Error("used wrong path:", used)
+	}
+	if got.Int != 5 || len(got.Map) != 2 {
+		t.Error("file not loaded:", got.Int, got.Map)
+	}
+	if g := got.MapPrim["one"]; g != 2 {
+		t.Error("mapprim one wrong:", g)
+	}
+
+	// Nothing found is only env
+	got = new(A)
+	_, used, err = TOMLSearch("test57", paths[:1], got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != "" || got.Int != 0 || got.MapPrim["one"] != 2 {
+		t.Error("expected only env to be loaded:", used, got.Int, got.MapPrim)
+	}
+}
+
+func TestTOMLEnvIgnored(t *testing.T) {
+	type Ignored struct {
+		Token string `toml:"token" loadcfg:"-"`
+		Port  int    `toml:"port"`
+	}
+
+	keys := setEnvs(
+		"TEST63_TOKEN", "from-env",
+		"TEST63_PORT", "8080",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Ignored)
+	if _, err := TOML("test63", "testdata/envignore.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Token != "from-file" {
+		t.Error("token should only come from the file:", got.Token)
+	}
+	if got.Port != 8080 {
+		t.Error("port wrong:", got.Port)
+	}
+
+	var l Loader
+	pseudoKeys, err := l.envPseudoKeys("toml", got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"port"}; !reflect.DeepEqual(want, pseudoKeys) {
+		t.Errorf("pseudo keys wrong, want: %v, got: %v", want, pseudoKeys)
+	}
+}
+
+func TestTOMLStrictFileKeys(t *testing.T) {
+	t.Parallel()
+
+	// Unknown keys are ignored by default
+	if _, err := TOML("test68", "testdata/unknown.toml", new(A)); err != nil {
+		t.Fatal(err)
+	}
+
+	l := Loader{StrictFileKeys: true}
+	_, err := l.TOML("test68", "testdata/unknown.toml", new(A))
+	if !errors.Is(err, ErrFieldNotFound) {
+		t.Fatal("expected unknown keys to be an error:", err)
+	}
+	for _, key := range []string{"prot", "struct.flaot"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("%s should be reported: %v", key, err)
+		}
+	}
+
+	if _, err := l.TOML("test68", "testdata/one.toml", new(A)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTOMLEnvFirst(t *testing.T) {
+	got := new(A)
+
+	keys := setEnvs(
+		"TEST38_INT", "6",
+		"TEST38_MAPPRIM_THREE", "3",
+	)
+
+	defer unsetEnvs(keys)
+
+	l := Loader{EnvFirst: true}
+	if _, err := l.TOML("test38", "testdata/one.toml", got); err != nil {
+		t.Error(err)
+	}
+
+	// The file sets int so it wins over the env
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if g := got.MapPrim["three"]; g != 3 {
+		t.Error("mapprim three wrong:", g)
+	}
+	if g := got.MapPrim["one"]; g != 1 {
+		t.Error("mapprim one wrong:", g)
+	}
+}
+
+func TestTOMLFileWins(t *testing.T) {
+	type Layered struct {
+		Int     int          `toml:"int"`
+		Default int          `toml:"default,filewins"`
+		Map     map[string]B `toml:"map,filewins"`
+	}
+
+	keys := setEnvs(
+		"TEST12_INT", "6",
+		"TEST12_DEFAULT", "6",
+		"TEST12_MAP_ONE_FLOAT", "5.5",
+		"TEST12_MAP_THREE_FLOAT", "5.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Layered)
+	if _, err := TOML("test12", "testdata/filewins.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Layered{
+		Int:     6,
+		Default: 5,
+		Map: map[string]B{
+			"one":   {Float: 4.5},
+			"three": {Float: 5.5},
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	// Without a file the env always applies
+	got = new(Layered)
+	if err := Env("test12", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Default != 6 {
+		t.Error("default wrong:", got.Default)
+	}
+}
+
+func TestTOMLClearSlice(t *testing.T) {
+	type Tags struct {
+		Tags  []string `toml:"tags"`
+		Hosts []string `toml:"hosts"`
+	}
+
+	keys := setEnvs("TEST25_TAGS", "[]")
+
+	defer unsetEnvs(keys)
+
+	got := new(Tags)
+	if _, err := TOML("test25", "testdata/tags.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Tags == nil || len(got.Tags) != 0 {
+		t.Errorf("tags should be empty but not nil: %#v", got.Tags)
+	}
+	if want := []string{"c", "d"}; !reflect.DeepEqual(want, got.Hosts) {
+		t.Errorf("hosts wrong, want: %v, got: %v", want, got.Hosts)
+	}
+}
+
+func TestTOMLNullSentinel(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"config.toml": &fstest.MapFile{Data: []byte("int = 5\nintptr = 5\n")},
+	}
+
+	l := Loader{
+		NullSentinel: "null",
+		Environ:      fakeEnvs("APP_INTPTR", "null", "APP_INT", "6"),
+	}
+
+	got := new(A)
+	if _, err := l.TOMLFS("app", fsys, "config.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.IntPtr != nil {
+		t.Error("intptr should be nil:", *got.IntPtr)
+	}
+	if got.Int != 6 {
+		t.Error("int wrong:", got.Int)
+	}
+
+	// Without the sentinel configured null is just a value
+	l.NullSentinel = ""
+	if _, err := l.TOMLFS("app", fsys, "config.toml", new(A)); !errors.Is(err, ErrParse) {
+		t.Error("expected null to fail to parse as an int:", err)
+	}
+}
+
+func TestEnvNullSentinelSquash(t *testing.T) {
+	t.Parallel()
+
+	type Inner struct {
+		Host string `toml:"host"`
+		Port *int   `toml:"port"`
+	}
+	type Outer struct {
+		*Inner `toml:",squash"`
+	}
+
+	port := 80
+	got := &Outer{Inner: &Inner{Host: "example.com", Port: &port}}
+	l := Loader{NullSentinel: "null", Environ: fakeEnvs("APP_PORT", "null")}
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Inner == nil {
+		t.Fatal("the squashed pointer should not be nulled")
+	}
+	if got.Host != "example.com" {
+		t.Error("host wrong:", got.Host)
+	}
+	if got.Port != nil {
+		t.Error("port should be nil:", *got.Port)
+	}
+}
+
+func TestTOMLOnShadow(t *testing.T) {
+	t.Parallel()
+
+	var shadowed []string
+	l := Loader{
+		Environ: fakeEnvs(
+			"APP_INT", "6",
+			"APP_MAP_ONE_FLOAT", "5.5",
+			"APP_MAP_THREE_FLOAT", "6.5",
+			"APP_MAPPRIM_TWO", "2",
+			"APP_STRUCT_FLOAT", "7.5",
+		),
+		OnShadow: func(key string) { shadowed = append(shadowed, key) },
+	}
+
+	got := new(A)
+	if _, err := l.TOML("app", "testdata/one.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 6 || got.Map["one"].Float != 5.5 {
+		t.Error("env values should still be set:", got.Int, got.Map)
+	}
+
+	sort.Strings(shadowed)
+	if want := []string{"int", "map.one.float", "mapprim.two"}; !reflect.DeepEqual(want, shadowed) {
+		t.Errorf("shadowed keys wrong, want: %v, got: %v", want, shadowed)
+	}
+
+	// Without a file nothing can be shadowed
+	shadowed = nil
+	if err := l.Env("app", "toml", new(A)); err != nil {
+		t.Fatal(err)
+	}
+	if len(shadowed) != 0 {
+		t.Error("nothing should be shadowed without a file:", shadowed)
+	}
+}
+
+func TestTOMLConfigFileEnv(t *testing.T) {
+	keys := setEnvs("TEST27_CONFIG", "testdata/one.toml")
+
+	defer unsetEnvs(keys)
+
+	l := Loader{ConfigFileEnv: "config"}
+
+	// two.toml doesn't exist, the env var should be used instead
+	got := new(A)
+	if _, err := l.TOML("test27", "testdata/two.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+
+	got = new(A)
+	if _, err := TOML("test27", "testdata/two.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Int != 0 {
+		t.Error("config file env should not be used by default:", got.Int)
+	}
+
+	// It has to be allowed like any other env var
+	l.AllowedKeys = []string{"TEST27_INT"}
+	got = new(A)
+	if _, err := l.TOML("test27", "testdata/two.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Int != 0 {
+		t.Error("config file env isn't in the allowed keys:", got.Int)
+	}
+
+	l.AllowedKeys = append(l.AllowedKeys, "TEST27_CONFIG")
+	if _, err := l.TOML("test27", "testdata/two.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Int != 5 {
+		t.Error("allowed config file env should be used:", got.Int)
+	}
+}
+
+func TestTOMLDynamicPrefix(t *testing.T) {
+	keys := setEnvs(
+		"TEST74_TENANT", "test74_acme",
+		"TEST74_ACME_INT", "6",
+	)
+
+	defer unsetEnvs(keys)
+
+	if got := PrefixFromEnv("TEST74_TENANT"); got != "test74_acme" {
+		t.Error("prefix wrong:", got)
+	}
+
+	got := new(A)
+	if _, err := TOMLDynamicPrefix("TEST74_TENANT", "testdata/one.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Int != 6 {
+		t.Error("int wrong:", got.Int)
+	}
+	if got.Map["one"].Float != 4.5 {
+		t.Error("the file should have been loaded")
+	}
+
+	if _, err := TOMLDynamicPrefix("TEST74_MISSING", "testdata/one.toml", new(A)); err == nil {
+		t.Error("expected an error when the prefix env var isn't set")
+	}
+}
+
 func TestTOMLOnlyEnv(t *testing.T) {
 	date := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
 
@@ -222,30 +665,102 @@ func TestTOMLOnlyEnv(t *testing.T) {
 	}
 }
 
-func TestEnv(t *testing.T) {
-	date := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
-
-	keys := setEnvs(
-		"TEST3_INT", "5",
-		"TEST3_INTPTR", "5",
-		"TEST3_STRINGS", "one,two,three",
-		"TEST3_TIME", date.Format(time.RFC3339),
+func TestTOMLFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.toml": &fstest.MapFile{
+			Data: []byte("int = 5\n\n[map.one]\nfloat = 4.5\n"),
+		},
+	}
 
-		// Inline struct
-		"TEST3_EMBEDDED_INT", "6",
+	keys := setEnvs("TEST11_MAP_ONE_FLOAT", "5.5")
 
-		// Maps
-		"TEST3_MAP_ONE_FLOAT", "4.5",
-		"TEST3_MAP_TWO_FLOAT", "5.5",
-		"TEST3_MAPPTR_ONE_FLOAT", "6.5",
-		"TEST3_MAPPTR_TWO_FLOAT", "7.5",
+	defer unsetEnvs(keys)
 
-		"TEST3_MAPPRIM_ONE", "1",
-		"TEST3_MAPPRIM_TWO", "2",
-		"TEST3_MAPPRIMPTR_ONE", "3",
-		"TEST3_MAPPRIMPTR_TWO", "4",
+	got := new(A)
+	if _, err := TOMLFS("test11", fsys, "config.toml", got); err != nil {
+		t.Fatal(err)
+	}
 
-		// Slices
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if g := got.Map["one"].Float; g != 5.5 {
+		t.Error("map float wrong:", g)
+	}
+
+	// missing.toml doesn't exist, we're explicitly checking env only
+	got = new(A)
+	if _, err := TOMLFS("test11", fsys, "missing.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := got.Map["one"].Float; g != 5.5 {
+		t.Error("map float wrong:", g)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	keys := setEnvs("TEST19_STRUCT_FLOAT", "5.5")
+
+	defer unsetEnvs(keys)
+
+	decode := func(obj interface{}) error {
+		a := obj.(*A)
+		a.Int = 5
+		a.Struct.Float = 4.5
+		return nil
+	}
+
+	got := new(A)
+	if err := Load("test19", "toml", decode, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if got.Struct.Float != 5.5 {
+		t.Error("struct float wrong:", got.Struct.Float)
+	}
+
+	notExist := func(obj interface{}) error {
+		_, err := os.Open("testdata/two.toml")
+		return err
+	}
+	if err := Load("test19", "toml", notExist, got); err != nil {
+		t.Error("missing files should not error:", err)
+	}
+
+	fail := func(obj interface{}) error { return errors.New("bad format") }
+	if err := Load("test19", "toml", fail, got); err == nil {
+		t.Error("expected decode error")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	date := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+
+	keys := setEnvs(
+		"TEST3_INT", "5",
+		"TEST3_INTPTR", "5",
+		"TEST3_STRINGS", "one,two,three",
+		"TEST3_TIME", date.Format(time.RFC3339),
+
+		// Inline struct
+		"TEST3_EMBEDDED_INT", "6",
+
+		// Maps
+		"TEST3_MAP_ONE_FLOAT", "4.5",
+		"TEST3_MAP_TWO_FLOAT", "5.5",
+		"TEST3_MAPPTR_ONE_FLOAT", "6.5",
+		"TEST3_MAPPTR_TWO_FLOAT", "7.5",
+
+		"TEST3_MAPPRIM_ONE", "1",
+		"TEST3_MAPPRIM_TWO", "2",
+		"TEST3_MAPPRIMPTR_ONE", "3",
+		"TEST3_MAPPRIMPTR_TWO", "4",
+
+		// Slices
 		"TEST3_SLICE_0_FLOAT", "8.5",
 		"TEST3_SLICE_1_FLOAT", "9.5",
 		"TEST3_SLICEPTR_0_FLOAT", "10.5",
@@ -308,28 +823,3155 @@ func TestEnv(t *testing.T) {
 	}
 }
 
-func TestNonStructs(t *testing.T) {
-	t.Parallel()
+func TestEnvIgnoreCase(t *testing.T) {
+	keys := setEnvs(
+		"test4_int", "5",
+		"test4_map_one_float", "4.5",
+		"Test4_Slice_0_Float", "5.5",
+	)
 
-	obj := make(map[string]int)
+	defer unsetEnvs(keys)
+
+	got := new(A)
+	if err := Env("test4", "toml", got); err != nil {
+		t.Error(err)
+	}
+	if got.Int != 0 {
+		t.Error("lowercase env should not match by default:", got.Int)
+	}
+
+	l := Loader{IgnoreCase: true}
+	if err := l.Env("test4", "toml", got); err != nil {
+		t.Error(err)
+	}
+
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if g := got.Map["one"].Float; g != 4.5 {
+		t.Error("map float wrong:", g)
+	}
+	if len(got.Slice) != 1 || got.Slice[0].Float != 5.5 {
+		t.Error("slice wrong:", got.Slice)
+	}
+}
+
+func TestEnvNumericMapKeys(t *testing.T) {
+	type Code struct {
+		Msg string `toml:"msg"`
+	}
+	type Codes struct {
+		Codes map[string]Code `toml:"codes"`
+		Pages []Code          `toml:"pages"`
+	}
+
+	keys := setEnvs(
+		"TEST5_CODES_404_MSG", "not found",
+		"TEST5_CODES_500_MSG", "oops",
+		"TEST5_PAGES_0_MSG", "first",
+	)
+
+	defer unsetEnvs(keys)
+
+	loaders := []Loader{
+		{},
+		{MapWildcard: '%', SliceWildcard: '$'},
+	}
+
+	for i, l := range loaders {
+		got := new(Codes)
+		if err := l.Env("test5", "toml", got); err != nil {
+			t.Errorf("%d) %v", i, err)
+		}
+
+		want := &Codes{
+			Codes: map[string]Code{
+				"404": {Msg: "not found"},
+				"500": {Msg: "oops"},
+			},
+			Pages: []Code{{Msg: "first"}},
+		}
 
-	err := overwriteStructVals("", map[string]string{"one": "1"}, obj)
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%d) structs differ:\nwant:\n%v\n\ngot:\n%v\n", i, want, got)
+		}
+	}
+
+	l := Loader{MapWildcard: '%', SliceWildcard: '$'}
+	pkeys, err := l.envPseudoKeys("toml", &Codes{})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if want := []string{"codes.%.msg", "pages.$.msg"}; !reflect.DeepEqual(want, pkeys) {
+		t.Errorf("pseudo keys wrong, want: %v, got: %v", want, pkeys)
+	}
+}
 
-	if obj["one"] != 1 {
-		t.Error("expected a value to be set")
+func TestEnvScalarSliceIndex(t *testing.T) {
+	type Ints struct {
+		Ints    []int    `toml:"ints"`
+		Strings []string `toml:"strings"`
 	}
 
-	sliceObj := make([]B, 0, 0)
-	err = overwriteStructVals("toml", map[string]string{"0.float": "1.0"}, &sliceObj)
-	if err != nil {
+	keys := setEnvs(
+		"TEST6_INTS_1", "5",
+		"TEST6_STRINGS", "a,b",
+		"TEST6_STRINGS_2", "c",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &Ints{
+		Ints:    []int{1, 2, 3},
+		Strings: []string{"x", "y", "z", "w"},
+	}
+	if err := Env("test6", "toml", got); err != nil {
+		t.Error(err)
+	}
+
+	want := &Ints{
+		Ints:    []int{1, 5, 3},
+		Strings: []string{"a", "b", "c"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvArraySlice(t *testing.T) {
+	t.Parallel()
+
+	type Lists struct {
+		Tags    []string    `toml:"tags"`
+		JSON    []string    `toml:"json"`
+		Ints    []int       `toml:"ints"`
+		Times   []time.Time `toml:"times"`
+		Plain   []string    `toml:"plain"`
+		Literal []string    `toml:"literal"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_TAGS", `["a", 'b,c', "d"]`,
+		"APP_JSON", `["x","y \"z\""]`,
+		"APP_INTS", `[1, 2, 3]`,
+		"APP_TIMES", `[2009-11-10T23:00:00Z]`,
+		"APP_PLAIN", `a,b`,
+		"APP_LITERAL", `[a,b]`,
+	)}
+
+	got := new(Lists)
+	if err := l.Env("app", "toml", got); err != nil {
 		t.Fatal(err)
 	}
 
-	if sliceObj[0].Float != 1.0 {
-		t.Error("slice not set correctly")
+	want := &Lists{
+		Tags:  []string{"a", "b,c", "d"},
+		JSON:  []string{"x", `y "z"`},
+		Ints:  []int{1, 2, 3},
+		Times: []time.Time{time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)},
+		Plain: []string{"a", "b"},
+		// Not a valid array so it's split like any other list
+		Literal: []string{"[a", "b]"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvSliceSep(t *testing.T) {
+	t.Parallel()
+
+	type Lists struct {
+		Hosts  []string `toml:"hosts,sep=newline"`
+		Ports  []int    `toml:"ports,sep=newline"`
+		Semi   []string `toml:"semi,sep=;"`
+		Commas []string `toml:"commas"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_HOSTS", "a.example.com\nb,c.example.com\r\n\"d\"\n",
+		"APP_PORTS", "80\n443",
+		"APP_SEMI", "a,b;c",
+		"APP_COMMAS", "a\nb,c",
+	)}
+
+	got := new(Lists)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Lists{
+		Hosts:  []string{"a.example.com", "b,c.example.com", `"d"`},
+		Ports:  []int{80, 443},
+		Semi:   []string{"a,b", "c"},
+		Commas: []string{"a\nb", "c"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%#v\n\ngot:\n%#v\n", want, got)
+	}
+}
+
+func TestEnvSliceNoSplit(t *testing.T) {
+	t.Parallel()
+
+	type Lists struct {
+		Raw   []string `toml:"raw,nosplit"`
+		Array []string `toml:"array,nosplit"`
+		Split []string `toml:"split"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_RAW", "a,b,c",
+		"APP_ARRAY", `["a", "b"]`,
+		"APP_SPLIT", "a,b,c",
+	)}
+
+	got := &Lists{Raw: []string{"old", "values"}}
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Lists{
+		Raw:   []string{"a,b,c"},
+		Array: []string{`["a", "b"]`},
+		Split: []string{"a", "b", "c"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvQuotedSlice(t *testing.T) {
+	type Lists struct {
+		Quoted  []string `toml:"quoted"`
+		Mixed   []string `toml:"mixed"`
+		Plain   []string `toml:"plain"`
+		Escaped []string `toml:"escaped"`
+		Bad     []string `toml:"bad"`
+	}
+
+	keys := setEnvs(
+		"TEST40_QUOTED", `"a,b",c`,
+		"TEST40_MIXED", `a,"b,c",d`,
+		"TEST40_PLAIN", `a,b,c`,
+		"TEST40_ESCAPED", `"say ""hi""",x`,
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Lists)
+	if err := Env("test40", "toml", got); err != nil {
+		t.Error(err)
+	}
+
+	want := &Lists{
+		Quoted:  []string{"a,b", "c"},
+		Mixed:   []string{"a", "b,c", "d"},
+		Plain:   []string{"a", "b", "c"},
+		Escaped: []string{`say "hi"`, "x"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	defer unsetEnvs(setEnvs("TEST40_BAD", `"a,b`))
+	if err := Env("test40", "toml", new(Lists)); !errors.Is(err, ErrParse) {
+		t.Error("expected a parse error for an unterminated quote:", err)
+	}
+}
+
+func TestEnvQuotedSliceEdges(t *testing.T) {
+	t.Parallel()
+
+	type Lists struct {
+		Inner []string `toml:"inner"`
+		Lines []string `toml:"lines"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_INNER", `say "hi",bye`,
+		"APP_LINES", "\"a\nb\",c",
+	)}
+	got := new(Lists)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Lists{
+		Inner: []string{`say "hi"`, "bye"},
+		Lines: []string{"a\nb", "c"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	// Records after the first line would otherwise be dropped
+	l.Environ = []string{"APP_LINES=\"a\",b\nc,d"}
+	if err := l.Env("app", "toml", new(Lists)); !errors.Is(err, ErrParse) {
+		t.Error("expected a parse error for a list over several lines:", err)
+	}
+}
+
+func TestEnvMapOfStringSlices(t *testing.T) {
+	type Headers struct {
+		H map[string][]string `toml:"h"`
+	}
+
+	keys := setEnvs(
+		"TEST48_H_ACCEPT", "a,b",
+		"TEST48_H_VARY_1", "origin",
+		"TEST48_H_NEW_0", "x",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &Headers{H: map[string][]string{"vary": {"accept"}}}
+	if err := Env("test48", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"accept": {"a", "b"},
+		"vary":   {"accept", "origin"},
+		"new":    {"x"},
+	}
+	if !reflect.DeepEqual(want, got.H) {
+		t.Errorf("headers wrong, want: %v, got: %v", want, got.H)
+	}
+}
+
+func TestEnvBoolSlice(t *testing.T) {
+	type Flags struct {
+		Flags []bool `toml:"flags"`
+		Bad   []bool `toml:"bad"`
+	}
+
+	keys := setEnvs(
+		"TEST53_FLAGS", "true,false,1,0,T,F",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Flags)
+	if err := Env("test53", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []bool{true, false, true, false, true, false}; !reflect.DeepEqual(want, got.Flags) {
+		t.Errorf("flags wrong, want: %v, got: %v", want, got.Flags)
+	}
+
+	defer unsetEnvs(setEnvs("TEST53_BAD", "true,maybe"))
+
+	err := Env("test53", "toml", got)
+	if !errors.Is(err, ErrParse) {
+		t.Fatal("expected a parse error:", err)
+	}
+	if !strings.Contains(err.Error(), "maybe") {
+		t.Error("the bad element should be in the error:", err)
+	}
+}
+
+func TestEnvJSONStruct(t *testing.T) {
+	type Server struct {
+		Host string `toml:"host" json:"host"`
+		Port int    `toml:"port" json:"port"`
+	}
+	type Config struct {
+		Server Server  `toml:"server,json"`
+		Admin  *Server `toml:"admin,json"`
+		Plain  Server  `toml:"plain"`
+		Bad    Server  `toml:"bad,json"`
+	}
+
+	keys := setEnvs(
+		"TEST56_SERVER", `{"host":"example.com","port":80}`,
+		"TEST56_SERVER_PORT", "8080",
+		"TEST56_ADMIN", `{"host":"admin.example.com"}`,
+		"TEST56_PLAIN", `{"host":"ignored"}`,
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Config)
+	if err := Env("test56", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The per field env var wins over the blob
+	if want := (Server{Host: "example.com", Port: 8080}); got.Server != want {
+		t.Errorf("server wrong, want: %v, got: %v", want, got.Server)
+	}
+	if got.Admin == nil || *got.Admin != (Server{Host: "admin.example.com"}) {
+		t.Error("admin wrong:", got.Admin)
+	}
+	if got.Plain != (Server{}) {
+		t.Error("plain should not be set from json:", got.Plain)
+	}
+
+	defer unsetEnvs(setEnvs("TEST56_BAD", `{"host":`))
+	if err := Env("test56", "toml", got); !errors.Is(err, ErrParse) {
+		t.Error("expected a parse error:", err)
+	}
+}
+
+func TestEnvFromMap(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"APP_INT":             "5",
+		"APP_STRINGS":         "a,b",
+		"APP_MAP_ONE_FLOAT":   "4.5",
+		"APP_SLICE_0_FLOAT":   "5.5",
+		"OTHER_INT":           "6",
+		"APP_STRUCTPTR_FLOAT": "6.5",
+	}
+
+	got := new(A)
+	if err := EnvFromMap(env, "app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if !reflect.DeepEqual([]string{"a", "b"}, got.Strings) {
+		t.Error("strings wrong:", got.Strings)
+	}
+	if g := got.Map["one"].Float; g != 4.5 {
+		t.Error("map float wrong:", g)
+	}
+	if len(got.Slice) != 1 || got.Slice[0].Float != 5.5 {
+		t.Error("slice wrong:", got.Slice)
+	}
+	if got.StructPtr == nil || got.StructPtr.Float != 6.5 {
+		t.Error("structptr wrong:", got.StructPtr)
+	}
+}
+
+func TestEnvFromMapExpand(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		URL string `toml:"url"`
+	}
+
+	env := map[string]string{
+		"P_URL": "http://${HOSTZ}",
+		"HOSTZ": "example",
+	}
+
+	l := Loader{Expand: true, Environ: fakeEnvs("HOSTZ", "other")}
+	got := new(Config)
+	if err := l.EnvFromMap(env, "p", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "http://example" {
+		t.Error("references should be expanded from the map:", got.URL)
+	}
+	if l.Environ[len(l.Environ)-1] != "HOSTZ=other" {
+		t.Error("the Loader's Environ should be left alone:", l.Environ)
+	}
+}
+
+func TestEnvWithResult(t *testing.T) {
+	t.Parallel()
+
+	l := Loader{
+		FileEnvSuffix: "_FILE",
+		Environ: fakeEnvs(
+			"APP_INT", "5",
+			"APP_MAP_ONE_FLOAT", "4.5",
+			"APP_MAP_TWO", "__delete__",
+			"APP_STRINGS_FILE", "testdata/password.txt",
+			"APP_STRUCT_FILE", "testdata/password.txt",
+			"APP_STRUCT_FLAOT", "5.5",
+			"APP_UNKNOWN", "x",
+			"OTHER_INT", "6",
+		),
+	}
+
+	got := &A{Map: map[string]B{"two": {Float: 1}}}
+	res, err := l.EnvWithResult("app", "toml", got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantApplied := map[string]string{
+		"int":           "5",
+		"map.one.float": "4.5",
+		"map.two":       "__delete__",
+		"strings":       "hunter2",
+	}
+	if !reflect.DeepEqual(wantApplied, res.Applied) {
+		t.Errorf("applied wrong\nwant: %v\ngot:  %v", wantApplied, res.Applied)
+	}
+
+	// STRUCT_FILE has the file suffix but there's no struct key to set
+	wantUnmatched := []string{"APP_STRUCT_FILE", "APP_STRUCT_FLAOT", "APP_UNKNOWN"}
+	if !reflect.DeepEqual(wantUnmatched, res.Unmatched) {
+		t.Errorf("unmatched wrong\nwant: %v\ngot:  %v", wantUnmatched, res.Unmatched)
+	}
+
+	if got.Int != 5 || got.Map["one"].Float != 4.5 {
+		t.Error("values should be set:", got.Int, got.Map)
+	}
+	if _, ok := got.Map["two"]; ok {
+		t.Error("map entry two should have been deleted")
+	}
+}
+
+func TestEnvSubset(t *testing.T) {
+	t.Parallel()
+
+	type DB struct {
+		Host string `toml:"host"`
+		Port int    `toml:"port"`
+		Pool struct {
+			Size int `toml:"size"`
+		} `toml:"pool"`
+	}
+	type Config struct {
+		Name  string   `toml:"name"`
+		DB    DB       `toml:"db"`
+		Hosts []string `toml:"hosts"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_NAME", "new",
+		"APP_DB_HOST", "db.example.com",
+		"APP_DB_PORT", "5432",
+		"APP_DB_POOL_SIZE", "10",
+		"APP_HOSTS", "a,b",
+	)}
+
+	got := &Config{Name: "old", Hosts: []string{"c"}}
+	if err := l.EnvSubset("app", "toml", "db.*", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{Name: "old", Hosts: []string{"c"}}
+	want.DB.Host = "db.example.com"
+	want.DB.Port = 5432
+	want.DB.Pool.Size = 10
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	if err := l.EnvSubset("app", "toml", "[", got); !errors.Is(err, path.ErrBadPattern) {
+		t.Error("expected a bad pattern error:", err)
+	}
+}
+
+type (
+	port    int
+	ports   []port
+	tag     string
+	tags    []tag
+	ratio   float32
+	enabled bool
+	bees    []B
+)
+
+func TestEnvNamedTypes(t *testing.T) {
+	t.Parallel()
+
+	type Named struct {
+		Port    port            `toml:"port"`
+		Ratio   ratio           `toml:"ratio"`
+		Enabled enabled         `toml:"enabled"`
+		Ports   ports           `toml:"ports"`
+		Tags    tags            `toml:"tags"`
+		Indexed tags            `toml:"indexed"`
+		Bees    bees            `toml:"bees"`
+		ByName  map[string]tags `toml:"byname"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_PORT", "80",
+		"APP_RATIO", "0.5",
+		"APP_ENABLED", "true",
+		"APP_PORTS", "80,443",
+		"APP_TAGS", "a,b",
+		"APP_INDEXED_1", "c",
+		"APP_BEES_1_FLOAT", "1.5",
+		"APP_BYNAME_ONE", "d,e",
+		"APP_BYNAME_TWO_0", "f",
+	)}
+
+	got := new(Named)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Named{
+		Port:    80,
+		Ratio:   0.5,
+		Enabled: true,
+		Ports:   ports{80, 443},
+		Tags:    tags{"a", "b"},
+		Indexed: tags{"", "c"},
+		Bees:    bees{{}, {Float: 1.5}},
+		ByName:  map[string]tags{"one": {"d", "e"}, "two": {"f"}},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%#v\n\ngot:\n%#v\n", want, got)
+	}
+}
+
+type headerName string
+
+type headers map[string]string
+
+func TestEnvNestedInlineStructs(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		A struct {
+			B struct {
+				C int `toml:"c"`
+				D *struct {
+					E string `toml:"e"`
+				} `toml:"d"`
+			} `toml:"b"`
+			F []struct {
+				G struct {
+					H float64 `toml:"h"`
+				} `toml:"g"`
+			} `toml:"f"`
+		} `toml:"a"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_A_B_C", "5",
+		"APP_A_B_D_E", "deep",
+		"APP_A_F_1_G_H", "1.5",
+	)}
+
+	got := new(Config)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.A.B.C != 5 {
+		t.Error("a.b.c wrong:", got.A.B.C)
+	}
+	if got.A.B.D == nil || got.A.B.D.E != "deep" {
+		t.Error("a.b.d.e wrong:", got.A.B.D)
+	}
+	if len(got.A.F) != 2 || got.A.F[1].G.H != 1.5 {
+		t.Error("a.f wrong:", got.A.F)
+	}
+}
+
+func TestEnvNamedMapTypes(t *testing.T) {
+	t.Parallel()
+
+	type Maps struct {
+		Headers headers               `toml:"headers"`
+		Keyed   map[headerName]string `toml:"keyed"`
+		Structs map[headerName]*B     `toml:"structs"`
+		Ints    map[int]string        `toml:"ints"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_HEADERS_ACCEPT", "text/plain",
+		"APP_KEYED_ACCEPT", "text/html",
+		"APP_STRUCTS_ONE_FLOAT", "1.5",
+	)}
+
+	got := &Maps{Keyed: map[headerName]string{"accept": "old", "other": "kept"}}
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (headers{"accept": "text/plain"}); !reflect.DeepEqual(want, got.Headers) {
+		t.Errorf("headers wrong, want: %v, got: %v", want, got.Headers)
+	}
+	if want := map[headerName]string{"accept": "text/html", "other": "kept"}; !reflect.DeepEqual(want, got.Keyed) {
+		t.Errorf("keyed wrong, want: %v, got: %v", want, got.Keyed)
+	}
+	if b := got.Structs["one"]; b == nil || b.Float != 1.5 {
+		t.Error("structs wrong:", got.Structs)
+	}
+
+	l.Environ = fakeEnvs("APP_INTS_1", "one")
+	if err := l.Env("app", "toml", got); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("expected an error for non-string map keys:", err)
+	}
+}
+
+func TestEnvMapPrimitivePointers(t *testing.T) {
+	t.Parallel()
+
+	type Ptrs struct {
+		Bools     map[string]*bool          `toml:"bools"`
+		Ints      map[string]*int64         `toml:"ints"`
+		Uints     map[string]*uint8         `toml:"uints"`
+		Floats    map[string]*float64       `toml:"floats"`
+		Strings   map[string]*string        `toml:"strings"`
+		Durations map[string]*time.Duration `toml:"durations"`
+		Times     map[string]*time.Time     `toml:"times"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_BOOLS_ON", "true",
+		"APP_BOOLS_OFF", "false",
+		"APP_INTS_ONE", "-1",
+		"APP_UINTS_ONE", "255",
+		"APP_FLOATS_ONE", "1.5",
+		"APP_STRINGS_ONE", "str",
+		"APP_DURATIONS_ONE", "5s",
+		"APP_TIMES_ONE", "2009-11-10T23:00:00Z",
+	)}
+
+	// An existing pointer is set through and a nil one is replaced
+	existing := false
+	got := &Ptrs{Bools: map[string]*bool{"on": nil, "off": &existing}}
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if b := got.Bools["on"]; b == nil || !*b {
+		t.Error("bools on wrong:", b)
+	}
+	if b := got.Bools["off"]; b != &existing || *b {
+		t.Error("bools off wrong:", b)
+	}
+	if i := got.Ints["one"]; i == nil || *i != -1 {
+		t.Error("ints wrong:", i)
+	}
+	if u := got.Uints["one"]; u == nil || *u != 255 {
+		t.Error("uints wrong:", u)
+	}
+	if f := got.Floats["one"]; f == nil || *f != 1.5 {
+		t.Error("floats wrong:", f)
+	}
+	if s := got.Strings["one"]; s == nil || *s != "str" {
+		t.Error("strings wrong:", s)
+	}
+	if d := got.Durations["one"]; d == nil || *d != 5*time.Second {
+		t.Error("durations wrong:", d)
+	}
+	if tm := got.Times["one"]; tm == nil || !tm.Equal(time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)) {
+		t.Error("times wrong:", tm)
+	}
+}
+
+func TestEnvMapOfStructSlices(t *testing.T) {
+	type Groups struct {
+		M map[string][]B  `toml:"m"`
+		P map[string][]*B `toml:"p"`
+	}
+
+	keys := setEnvs(
+		"TEST59_M_a_0_FLOAT", "1.5",
+		"TEST59_M_a_1_FLOAT", "2.5",
+		"TEST59_M_B_1_FLOAT", "3.5",
+		"TEST59_P_a_0_FLOAT", "4.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &Groups{M: map[string][]B{"b": {{Float: 9}, {Float: 8}}}}
+	if err := Env("test59", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]B{
+		"a": {{Float: 1.5}, {Float: 2.5}},
+		"b": {{Float: 9}, {Float: 3.5}},
+	}
+	if !reflect.DeepEqual(want, got.M) {
+		t.Errorf("m wrong, want: %v, got: %v", want, got.M)
+	}
+	if p := got.P["a"]; len(p) != 1 || p[0].Float != 4.5 {
+		t.Error("p wrong:", p)
+	}
+}
+
+type withSetters struct {
+	value string `toml:"value"`
+	port  int    `toml:"port"`
+	other string `toml:"other"`
+}
+
+func (w *withSetters) SetValue(s string) { w.value = s }
+
+func (w *withSetters) SetPort(s string) error {
+	p, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	w.port = p
+	return nil
+}
+
+func TestEnvSetterMethods(t *testing.T) {
+	keys := setEnvs(
+		"TEST64_VALUE", "hello",
+		"TEST64_PORT", "8080",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(withSetters)
+	if err := Env("test64", "toml", got); !errors.Is(err, ErrUnsettable) {
+		t.Error("expected unsettable without the option:", err)
+	}
+
+	l := Loader{SetterMethods: true}
+	if err := l.Env("test64", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.value != "hello" || got.port != 8080 {
+		t.Error("values wrong:", got.value, got.port)
+	}
+
+	// Fields without a setter are still unsettable and setter errors are
+	// returned
+	defer unsetEnvs(setEnvs("TEST64_OTHER", "x"))
+	if err := l.Env("test64", "toml", got); !errors.Is(err, ErrUnsettable) {
+		t.Error("expected unsettable for a field without a setter:", err)
+	}
+
+	defer unsetEnvs(setEnvs("TEST64_OTHER", "", "TEST64_PORT", "abc"))
+	if err := l.Env("test64", "toml", got); err == nil || !strings.Contains(err.Error(), "port") {
+		t.Error("expected the setter's error:", err)
+	}
+}
+
+func TestEnvSliceOfSlicePointers(t *testing.T) {
+	type Nested struct {
+		X []*[]int `toml:"x"`
+	}
+
+	keys := setEnvs(
+		"TEST67_X_0_0", "1",
+		"TEST67_X_0_1", "2",
+		"TEST67_X_1", "3,4",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Nested)
+	if err := Env("test67", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.X) != 2 || got.X[0] == nil || got.X[1] == nil {
+		t.Fatal("x wrong:", got.X)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(want, *got.X[0]) {
+		t.Errorf("x 0 wrong, want: %v, got: %v", want, *got.X[0])
+	}
+	if want := []int{3, 4}; !reflect.DeepEqual(want, *got.X[1]) {
+		t.Errorf("x 1 wrong, want: %v, got: %v", want, *got.X[1])
+	}
+}
+
+func TestEnvFieldNameFallback(t *testing.T) {
+	type Untagged struct {
+		Port    int
+		Server  B
+		Skipped int `toml:"-"`
+		Tagged  int `toml:"renamed"`
+	}
+
+	keys := setEnvs(
+		"TEST71_PORT", "8080",
+		"TEST71_SERVER_FLOAT", "4.5",
+		"TEST71_SKIPPED", "1",
+		"TEST71_RENAMED", "2",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Untagged)
+	if err := Env("test71", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Port != 0 || got.Tagged != 2 {
+		t.Error("untagged fields should be skipped by default:", got)
+	}
+
+	got = new(Untagged)
+	l := Loader{UseFieldNameFallback: true}
+	if err := l.Env("test71", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Untagged{Port: 8080, Server: B{Float: 4.5}, Tagged: 2}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvNoPrefix(t *testing.T) {
+	type Global struct {
+		Port  int  `toml:"port"`
+		Debug bool `toml:"debug"`
+	}
+
+	keys := setEnvs("PORT", "8080")
+
+	defer unsetEnvs(keys)
+
+	got := new(Global)
+	if err := Env("", "toml", got); err != nil {
+		t.Error(err)
+	}
+
+	if got.Port != 8080 {
+		t.Error("port wrong:", got.Port)
+	}
+	if got.Debug {
+		t.Error("debug should not be set")
+	}
+}
+
+func TestEnvMapSiblings(t *testing.T) {
+	keys := setEnvs(
+		"TEST8_MAP_A_FLOAT", "5.5",
+		"TEST8_MAPPTR_A_FLOAT", "5.5",
+		"TEST8_MAPPRIM_A", "5",
+		"TEST8_MAPPRIMPTR_A", "5",
+	)
+
+	defer unsetEnvs(keys)
+
+	int1, int2 := 1, 2
+	got := &A{
+		Map:        map[string]B{"a": {Float: 1.5}, "b": {Float: 2.5}},
+		MapPtr:     map[string]*B{"a": nil, "b": {Float: 2.5}},
+		MapPrim:    map[string]int{"a": 1, "b": 2},
+		MapPrimPtr: map[string]*int{"a": &int1, "b": &int2},
+	}
+
+	if err := Env("test8", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name  string
+		A     interface{}
+		B     interface{}
+		WantA interface{}
+		WantB interface{}
+	}{
+		{"map", got.Map["a"].Float, got.Map["b"].Float, 5.5, 2.5},
+		{"mapptr", got.MapPtr["a"].Float, got.MapPtr["b"].Float, 5.5, 2.5},
+		{"mapprim", got.MapPrim["a"], got.MapPrim["b"], 5, 2},
+		{"mapprimptr", *got.MapPrimPtr["a"], *got.MapPrimPtr["b"], 5, 2},
+	}
+
+	for _, test := range tests {
+		if test.A != test.WantA {
+			t.Errorf("%s) overridden key wrong, want: %v, got: %v", test.Name, test.WantA, test.A)
+		}
+		if test.B != test.WantB {
+			t.Errorf("%s) sibling key wrong, want: %v, got: %v", test.Name, test.WantB, test.B)
+		}
+	}
+}
+
+type hostPort struct {
+	Host string
+	Port int
+}
+
+func (h *hostPort) LoadCfgSet(s string) error {
+	idx := strings.LastIndexByte(s, ':')
+	if idx < 0 {
+		return fmt.Errorf("expected host:port but got: %q", s)
+	}
+
+	port, err := strconv.Atoi(s[idx+1:])
+	if err != nil {
+		return err
+	}
+
+	h.Host, h.Port = s[:idx], port
+	return nil
+}
+
+func TestEnvSetter(t *testing.T) {
+	type Server struct {
+		Addr    hostPort            `toml:"addr"`
+		AddrPtr *hostPort           `toml:"addrptr"`
+		Backups map[string]hostPort `toml:"backups"`
+	}
+
+	keys := setEnvs(
+		"TEST9_ADDR", "localhost:8080",
+		"TEST9_ADDRPTR", "127.0.0.1:80",
+		"TEST9_BACKUPS_ONE", "backup:9000",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Server)
+	if err := Env("test9", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Server{
+		Addr:    hostPort{Host: "localhost", Port: 8080},
+		AddrPtr: &hostPort{Host: "127.0.0.1", Port: 80},
+		Backups: map[string]hostPort{"one": {Host: "backup", Port: 9000}},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	os.Setenv("TEST9_ADDR", "localhost")
+	if err := Env("test9", "toml", got); err == nil {
+		t.Error("expected an error from LoadCfgSet")
+	}
+}
+
+// ipList parses a space separated list instead of a comma separated one
+type ipList []string
+
+func (i *ipList) LoadCfgSet(s string) error {
+	*i = strings.Fields(s)
+	return nil
+}
+
+// labels parses key=value pairs separated by semicolons
+type labels map[string]string
+
+func (l *labels) LoadCfgSet(s string) error {
+	*l = make(labels)
+	for _, pair := range strings.Split(s, ";") {
+		k, v, _ := strings.Cut(pair, "=")
+		(*l)[k] = v
+	}
+	return nil
+}
+
+func TestEnvSetterContainers(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		IPs    ipList  `toml:"ips"`
+		Labels *labels `toml:"labels"`
+	}
+
+	var l Loader
+	pseudoKeys, err := l.envPseudoKeys("toml", new(Config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ips", "labels"}; !reflect.DeepEqual(want, pseudoKeys) {
+		t.Errorf("setters shouldn't be recursed into, want: %v, got: %v", want, pseudoKeys)
+	}
+
+	l.Environ = fakeEnvs("APP_IPS", "10.0.0.1 10.0.0.2", "APP_LABELS", "a=1;b=2")
+	got := new(Config)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		IPs:    ipList{"10.0.0.1", "10.0.0.2"},
+		Labels: &labels{"a": "1", "b": "2"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvDurations(t *testing.T) {
+	type Retry struct {
+		Timeout time.Duration   `toml:"timeout"`
+		Backoff []time.Duration `toml:"backoff"`
+	}
+
+	keys := setEnvs(
+		"TEST10_TIMEOUT", "1500",
+		"TEST10_BACKOFF", "100ms,1s,5s,7",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Retry)
+	if err := Env("test10", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Retry{
+		Timeout: 1500 * time.Nanosecond,
+		Backoff: []time.Duration{100 * time.Millisecond, time.Second, 5 * time.Second, 7},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	os.Setenv("TEST10_BACKOFF", "1s,soon")
+	if err := Env("test10", "toml", got); err == nil {
+		t.Error("expected an error for a bad duration")
+	}
+}
+
+func TestEnvHyphenatedMapKeys(t *testing.T) {
+	type Region struct {
+		X int `toml:"x"`
+	}
+	type Regions struct {
+		Regions map[string]Region `toml:"regions"`
+	}
+
+	envs := fakeEnvs(
+		"TEST13_REGIONS_us-east-1_X", "1",
+		"TEST13_REGIONS_EU-WEST-2_X", "2",
+	)
+
+	loaders := map[string]*Loader{
+		"lower":    {IgnoreCase: true},
+		"preserve": {IgnoreCase: true, PreserveWildcardCase: true},
+	}
+	wants := map[string]map[string]Region{
+		"lower": {
+			"us-east-1": {X: 1},
+			"eu-west-2": {X: 2},
+		},
+		"preserve": {
+			"us-east-1": {X: 1},
+			"EU-WEST-2": {X: 2},
+		},
+	}
+
+	for name, l := range loaders {
+		pseudoKeys, err := l.envPseudoKeys("toml", &Regions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := new(Regions)
+		kvs := l.findKeyValues(envs, "test13", pseudoKeys)
+		if err := l.overwriteStructVals("toml", kvs, got); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := wants[name]; !reflect.DeepEqual(want, got.Regions) {
+			t.Errorf("%s) map differs:\nwant:\n%v\n\ngot:\n%v\n", name, want, got.Regions)
+		}
+	}
+}
+
+func TestEnvPreserveWildcardCase(t *testing.T) {
+	type M struct {
+		M map[string]struct {
+			X int `toml:"x"`
+		} `toml:"m"`
+	}
+
+	keys := setEnvs("TEST14_M_CamelKey_X", "1")
+
+	defer unsetEnvs(keys)
+
+	got := new(M)
+	if err := Env("test14", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.M["camelkey"]; !ok {
+		t.Errorf("expected lowercased key by default: %v", got.M)
+	}
+
+	got = new(M)
+	l := Loader{PreserveWildcardCase: true}
+	if err := l.Env("test14", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := got.M["CamelKey"]; !ok || v.X != 1 {
+		t.Errorf("expected case to be preserved: %v", got.M)
+	}
+}
+
+func TestSkipMissingFields(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]string{
+		"int":            "5",
+		"struct.float":   "5.5",
+		"missing.float":  "1",
+		"struct.missing": "2",
+		"int.extra":      "3",
+	}
+
+	var l Loader
+	if err := l.overwriteStructVals("toml", values, new(A)); !errors.Is(err, ErrFieldNotFound) {
+		t.Error("expected a field not found error:", err)
+	}
+
+	var warnings []string
+	l = Loader{
+		SkipMissingFields: true,
+		Warn:              func(err error) { warnings = append(warnings, err.Error()) },
+	}
+
+	got := new(A)
+	if err := l.overwriteStructVals("toml", values, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 5 || got.Struct.Float != 5.5 {
+		t.Error("the other values should be set:", got.Int, got.Struct.Float)
+	}
+	if len(warnings) != 3 {
+		t.Fatalf("want 3 warnings, got: %q", warnings)
+	}
+	for _, key := range []string{"missing.float", "struct.missing", "int.extra"} {
+		found := false
+		for _, w := range warnings {
+			found = found || strings.Contains(w, key)
+		}
+		if !found {
+			t.Errorf("no warning for %s in: %q", key, warnings)
+		}
+	}
+}
+
+func TestEnvSkipUnsettable(t *testing.T) {
+	type Unsettable struct {
+		Int    int `toml:"int"`
+		hidden struct {
+			Int int `toml:"int"`
+		} `toml:"hidden"`
+		hiddenPtr *B `toml:"hiddenptr"`
+	}
+
+	keys := setEnvs(
+		"TEST15_INT", "5",
+		"TEST15_HIDDEN_INT", "5",
+		"TEST15_HIDDENPTR_FLOAT", "5.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	err := Env("test15", "toml", new(Unsettable))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "hidden.int") {
+		t.Error("error should contain the full path:", err)
+	}
+
+	var warnings []error
+	l := Loader{
+		SkipUnsettable: true,
+		Warn:           func(err error) { warnings = append(warnings, err) },
+	}
+
+	got := new(Unsettable)
+	if err := l.Env("test15", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if got.hidden.Int != 0 || got.hiddenPtr != nil {
+		t.Error("unsettable fields should not be set")
+	}
+	if len(warnings) != 2 {
+		t.Error("expected two warnings:", warnings)
+	}
+}
+
+func TestEnvLocalTimes(t *testing.T) {
+	type Dates struct {
+		Date     time.Time `toml:"date"`
+		Datetime time.Time `toml:"datetime"`
+		Time     time.Time `toml:"time"`
+	}
+
+	keys := setEnvs(
+		"TEST16_DATE", "2024-06-01",
+		"TEST16_DATETIME", "2024-06-01T10:30:00",
+		"TEST16_TIME", "10:30:00",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Dates)
+	if err := Env("test16", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Dates{
+		Date:     time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local),
+		Datetime: time.Date(2024, 6, 1, 10, 30, 0, 0, time.Local),
+		Time:     time.Date(0, 1, 1, 10, 30, 0, 0, time.Local),
+	}
+	if !want.Date.Equal(got.Date) {
+		t.Error("date wrong:", got.Date)
+	}
+	if !want.Datetime.Equal(got.Datetime) {
+		t.Error("datetime wrong:", got.Datetime)
+	}
+	if !want.Time.Equal(got.Time) {
+		t.Error("time wrong:", got.Time)
+	}
+}
+
+func TestEnvRelativeTimes(t *testing.T) {
+	type Times struct {
+		Now      time.Time `toml:"now,relative"`
+		Later    time.Time `toml:"later,relative"`
+		Earlier  time.Time `toml:"earlier,relative"`
+		Absolute time.Time `toml:"absolute,relative"`
+		Plain    time.Time `toml:"plain"`
+	}
+
+	keys := setEnvs(
+		"TEST49_NOW", "now",
+		"TEST49_LATER", "now+1h",
+		"TEST49_EARLIER", "now-30m",
+		"TEST49_ABSOLUTE", "2009-11-10T23:00:00Z",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Times)
+	before := time.Now()
+	if err := Env("test49", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	within := func(name string, got time.Time, offset time.Duration) {
+		t.Helper()
+		if got.Before(before.Add(offset)) || got.After(after.Add(offset)) {
+			t.Errorf("%s wrong, want about: %v, got: %v", name, before.Add(offset), got)
+		}
+	}
+	within("now", got.Now, 0)
+	within("later", got.Later, time.Hour)
+	within("earlier", got.Earlier, -30*time.Minute)
+
+	if want := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC); !want.Equal(got.Absolute) {
+		t.Error("absolute wrong:", got.Absolute)
+	}
+
+	// Without the option now is not a time
+	defer unsetEnvs(setEnvs("TEST49_PLAIN", "now"))
+	if err := Env("test49", "toml", got); !errors.Is(err, ErrParse) {
+		t.Error("expected a parse error:", err)
+	}
+}
+
+func TestEnvTrimQuotes(t *testing.T) {
+	type Quoted struct {
+		Single    string   `toml:"single"`
+		Double    string   `toml:"double"`
+		Unmatched string   `toml:"unmatched"`
+		Backtick  string   `toml:"backtick"`
+		Names     []string `toml:"names"`
+	}
+
+	keys := setEnvs(
+		"TEST58_SINGLE", "'hello'",
+		"TEST58_DOUBLE", `"hello world"`,
+		"TEST58_UNMATCHED", `'hello"`,
+		"TEST58_BACKTICK", "`hello`",
+		"TEST58_NAMES", "'a','b',c",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Quoted)
+	l := Loader{TrimQuotes: `"'`}
+	if err := l.Env("test58", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Quoted{
+		Single:    "hello",
+		Double:    "hello world",
+		Unmatched: `'hello"`,
+		Backtick:  "`hello`",
+		Names:     []string{"a", "b", "c"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvTimePointers(t *testing.T) {
+	t.Parallel()
+
+	type Times struct {
+		Time     *time.Time       `toml:"time"`
+		Existing *time.Time       `toml:"existing"`
+		Day      *time.Time       `toml:"day,layout=2006-01-02"`
+		Timeout  *time.Duration   `toml:"timeout"`
+		Nanos    *time.Duration   `toml:"nanos"`
+		Times    []*time.Time     `toml:"times"`
+		Unset    *time.Time       `toml:"unset"`
+		Waits    []*time.Duration `toml:"waits"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_TIME", "2009-11-10T23:00:00Z",
+		"APP_EXISTING", "2010-11-10T23:00:00Z",
+		"APP_DAY", "2011-11-10",
+		"APP_TIMEOUT", "5s",
+		"APP_NANOS", "100",
+		"APP_TIMES_1", "2012-11-10T23:00:00Z",
+		"APP_WAITS_0", "1m",
+	)}
+
+	existing := time.Time{}
+	got := &Times{Existing: &existing}
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(year int) time.Time {
+		return time.Date(year, 11, 10, 23, 0, 0, 0, time.UTC)
+	}
+	if got.Time == nil || !got.Time.Equal(date(2009)) {
+		t.Error("time wrong:", got.Time)
+	}
+	if got.Existing != &existing || !existing.Equal(date(2010)) {
+		t.Error("existing pointer should be set through:", got.Existing)
+	}
+	if want := time.Date(2011, 11, 10, 0, 0, 0, 0, time.Local); got.Day == nil || !got.Day.Equal(want) {
+		t.Error("day wrong:", got.Day)
+	}
+	if got.Timeout == nil || *got.Timeout != 5*time.Second {
+		t.Error("timeout wrong:", got.Timeout)
+	}
+	if got.Nanos == nil || *got.Nanos != 100 {
+		t.Error("nanos wrong:", got.Nanos)
+	}
+	if len(got.Times) != 2 || got.Times[0] != nil || got.Times[1] == nil || !got.Times[1].Equal(date(2012)) {
+		t.Error("times wrong:", got.Times)
+	}
+	if got.Unset != nil {
+		t.Error("unset should not be allocated:", got.Unset)
+	}
+	if len(got.Waits) != 1 || got.Waits[0] == nil || *got.Waits[0] != time.Minute {
+		t.Error("waits wrong:", got.Waits)
+	}
+}
+
+type timestamp struct {
+	time.Time
+}
+
+func TestEnvTimeWrapper(t *testing.T) {
+	t.Parallel()
+
+	type Stamps struct {
+		Created timestamp            `toml:"created"`
+		Updated *timestamp           `toml:"updated"`
+		Day     timestamp            `toml:"day,layout=2006-01-02"`
+		History []timestamp          `toml:"history"`
+		Named   map[string]timestamp `toml:"named"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_CREATED", "2009-11-10T23:00:00Z",
+		"APP_UPDATED", "2010-11-10T23:00:00Z",
+		"APP_DAY", "2011-11-10",
+		"APP_HISTORY", "2012-11-10T23:00:00Z,2013-11-10T23:00:00Z",
+		"APP_NAMED_FIRST", "2014-11-10T23:00:00Z",
+	)}
+
+	got := new(Stamps)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(year int) timestamp {
+		return timestamp{time.Date(year, 11, 10, 23, 0, 0, 0, time.UTC)}
+	}
+	if !got.Created.Equal(date(2009).Time) {
+		t.Error("created wrong:", got.Created)
+	}
+	if got.Updated == nil || !got.Updated.Equal(date(2010).Time) {
+		t.Error("updated wrong:", got.Updated)
+	}
+	if want := time.Date(2011, 11, 10, 0, 0, 0, 0, time.Local); !got.Day.Equal(want) {
+		t.Error("day wrong:", got.Day)
+	}
+	if len(got.History) != 2 || !got.History[0].Equal(date(2012).Time) || !got.History[1].Equal(date(2013).Time) {
+		t.Error("history wrong:", got.History)
+	}
+	if !got.Named["first"].Equal(date(2014).Time) {
+		t.Error("named wrong:", got.Named)
+	}
+}
+
+func TestEnvTimeLayout(t *testing.T) {
+	type Days struct {
+		Holidays []time.Time          `toml:"holidays,layout=2006-01-02"`
+		Named    map[string]time.Time `toml:"named,layout=02/01/2006"`
+		Single   time.Time            `toml:"single,layout=20060102"`
+		Times    []time.Time          `toml:"times"`
+	}
+
+	keys := setEnvs(
+		"TEST62_HOLIDAYS", "2024-12-25,2025-01-01",
+		"TEST62_HOLIDAYS_2", "2025-07-04",
+		"TEST62_NAMED_XMAS", "25/12/2024",
+		"TEST62_SINGLE", "20240601",
+		"TEST62_TIMES", "2009-11-10T23:00:00Z",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Days)
+	if err := Env("test62", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	xmas := time.Date(2024, 12, 25, 0, 0, 0, 0, time.Local)
+	want := &Days{
+		Holidays: []time.Time{xmas, time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local), time.Date(2025, 7, 4, 0, 0, 0, 0, time.Local)},
+		Named:    map[string]time.Time{"xmas": xmas},
+		Single:   time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local),
+		Times:    []time.Time{time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	defer unsetEnvs(setEnvs("TEST62_SINGLE", "2024-06-01"))
+	if err := Env("test62", "toml", got); !errors.Is(err, ErrParse) {
+		t.Error("expected a parse error for the wrong layout:", err)
+	}
+}
+
+func TestEnvTrimQuotesNumbers(t *testing.T) {
+	type Numbers struct {
+		Port    int           `toml:"port"`
+		Ratio   float64       `toml:"ratio"`
+		Debug   bool          `toml:"debug"`
+		Timeout time.Duration `toml:"timeout"`
+		Ports   []uint16      `toml:"ports"`
+	}
+
+	keys := setEnvs(
+		"TEST69_PORT", `"8080"`,
+		"TEST69_RATIO", "'0.5'",
+		"TEST69_DEBUG", `"true"`,
+		"TEST69_TIMEOUT", `"5s"`,
+		"TEST69_PORTS", `"80","443"`,
+	)
+
+	defer unsetEnvs(keys)
+
+	if err := Env("test69", "toml", new(Numbers)); !errors.Is(err, ErrParse) {
+		t.Error("quoted numbers should not parse by default:", err)
+	}
+
+	got := new(Numbers)
+	l := Loader{TrimQuotes: `"'`}
+	if err := l.Env("test69", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Numbers{Port: 8080, Ratio: 0.5, Debug: true, Timeout: 5 * time.Second, Ports: []uint16{80, 443}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvTimeLayoutNames(t *testing.T) {
+	type Named struct {
+		HTTP    time.Time `toml:"http,layout=RFC1123"`
+		Mail    time.Time `toml:"mail,layout=RFC822Z"`
+		Kitchen time.Time `toml:"kitchen,layout=Kitchen"`
+		Unknown time.Time `toml:"unknown,layout=RFC9999"`
+	}
+
+	keys := setEnvs(
+		"TEST70_HTTP", "Mon, 02 Jan 2006 15:04:05 UTC",
+		"TEST70_MAIL", "02 Jan 06 15:04 -0700",
+		"TEST70_KITCHEN", "3:04PM",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Named)
+	if err := Env("test70", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC); !want.Equal(got.HTTP) {
+		t.Error("http wrong:", got.HTTP)
+	}
+	if want := time.Date(2006, 1, 2, 22, 4, 0, 0, time.UTC); !want.Equal(got.Mail) {
+		t.Error("mail wrong:", got.Mail)
+	}
+	if got.Kitchen.Hour() != 15 || got.Kitchen.Minute() != 4 {
+		t.Error("kitchen wrong:", got.Kitchen)
+	}
+
+	defer unsetEnvs(setEnvs("TEST70_UNKNOWN", "anything"))
+	err := Env("test70", "toml", got)
+	if !errors.Is(err, ErrUnsupportedType) || !strings.Contains(err.Error(), "RFC9999") {
+		t.Error("expected an unknown layout error:", err)
+	}
+}
+
+func TestEnvExpand(t *testing.T) {
+	type Expand struct {
+		URL   string   `toml:"url"`
+		Price string   `toml:"price"`
+		Hosts []string `toml:"hosts"`
+	}
+
+	keys := setEnvs(
+		"TEST17HOST", "localhost",
+		"TEST17PORT", "8080",
+		"TEST17_URL", "https://${TEST17HOST}:${TEST17PORT}",
+		"TEST17_PRICE", "$$5",
+		"TEST17_HOSTS", "$TEST17HOST,other",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Expand)
+	if err := Env("test17", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "https://${TEST17HOST}:${TEST17PORT}" {
+		t.Error("should not expand by default:", got.URL)
+	}
+
+	l := Loader{Expand: true}
+	if err := l.Env("test17", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Expand{
+		URL:   "https://localhost:8080",
+		Price: "$5",
+		Hosts: []string{"localhost", "other"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	l.ExpandMapping = func(name string) string { return "[" + name + "]" }
+	if err := l.Env("test17", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "https://[TEST17HOST]:[TEST17PORT]" {
+		t.Error("custom mapping not used:", got.URL)
+	}
+}
+
+func TestTOMLExpandFile(t *testing.T) {
+	t.Parallel()
+
+	type Expand struct {
+		BaseURL string            `toml:"base_url"`
+		Hosts   []string          `toml:"hosts"`
+		Headers map[string]string `toml:"headers"`
+		Default string            `toml:"default"`
+		Env     string            `toml:"env"`
+	}
+
+	fsys := fstest.MapFS{
+		"config.toml": &fstest.MapFile{Data: []byte(`base_url = "https://${HOST}:${PORT}"
+hosts = ["$HOST", "other"]
+[headers]
+host = "${HOST}"
+`)},
+	}
+
+	vars := map[string]string{"HOST": "localhost", "PORT": "8080"}
+	for _, envFirst := range []bool{false, true} {
+		l := Loader{
+			Expand:        true,
+			EnvFirst:      envFirst,
+			ExpandMapping: func(name string) string { return vars[name] },
+			// $$ is expanded to $ once, a second expansion would lose it
+			Environ: fakeEnvs("APP_ENV", "$$HOST"),
+		}
+
+		// Defaults that aren't from the file are left alone
+		got := &Expand{Default: "${HOST}"}
+		if _, err := l.TOMLFS("app", fsys, "config.toml", got); err != nil {
+			t.Fatal(err)
+		}
+
+		want := &Expand{
+			BaseURL: "https://localhost:8080",
+			Hosts:   []string{"localhost", "other"},
+			Headers: map[string]string{"host": "localhost"},
+			Default: "${HOST}",
+			Env:     "$HOST",
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("envfirst %t: structs differ:\nwant:\n%v\n\ngot:\n%v\n", envFirst, want, got)
+		}
+	}
+}
+
+func TestEnvOnlyChanges(t *testing.T) {
+	keys := setEnvs(
+		"TEST20_INT", "5",
+		"TEST20_STRINGS", "a,b",
+		"TEST20_STRUCT_FLOAT", "5.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	var changed []string
+	l := Loader{
+		OnlyChanges: true,
+		OnChange:    func(key string) { changed = append(changed, key) },
+	}
+
+	got := &A{Int: 5, Strings: []string{"a", "b"}, Struct: B{Float: 4.5}}
+	if err := l.Env("test20", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Struct.Float != 5.5 {
+		t.Error("struct float wrong:", got.Struct.Float)
+	}
+	if want := []string{"struct.float"}; !reflect.DeepEqual(want, changed) {
+		t.Errorf("changed keys wrong, want: %v, got: %v", want, changed)
+	}
+}
+
+func TestEnvValueTransform(t *testing.T) {
+	t.Parallel()
+
+	reverse := func(path []string, raw string) (string, error) {
+		r := []rune(raw)
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	}
+
+	var paths []string
+	l := &Loader{Environ: fakeEnvs(
+		"APP_INT", "21",
+		"APP_STRINGS", "cba,fed",
+		"APP_MAP_ONE_FLOAT", "5.4",
+	)}
+	l.WithValueTransform(reverse).WithValueTransform(func(path []string, raw string) (string, error) {
+		paths = append(paths, strings.Join(path, "."))
+		return raw, nil
+	})
+
+	got := new(A)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 12 {
+		t.Error("int wrong:", got.Int)
+	}
+	if want := []string{"def", "abc"}; !reflect.DeepEqual(want, got.Strings) {
+		t.Error("strings wrong:", got.Strings)
+	}
+	if got.Map["one"].Float != 4.5 {
+		t.Error("map float wrong:", got.Map["one"].Float)
+	}
+
+	sort.Strings(paths)
+	if want := []string{"int", "map.one.float", "strings"}; !reflect.DeepEqual(want, paths) {
+		t.Errorf("paths wrong, want: %v, got: %v", want, paths)
+	}
+
+	errDecrypt := errors.New("decrypt failed")
+	l.ValueTransforms = []func([]string, string) (string, error){
+		func([]string, string) (string, error) { return "", errDecrypt },
+	}
+	if err := l.Env("app", "toml", new(A)); !errors.Is(err, errDecrypt) {
+		t.Error("expected the transform's error:", err)
+	}
+}
+
+func TestEnvOnApply(t *testing.T) {
+	t.Parallel()
+
+	applied := make(map[string][2]interface{})
+	l := Loader{
+		Environ: fakeEnvs(
+			"APP_INT", "5",
+			"APP_STRINGS", "c,d",
+			"APP_STRUCT_FLOAT", "5.5",
+			"APP_MAP_ONE_FLOAT", "6.5",
+		),
+		OnApply: func(key string, oldVal, newVal reflect.Value) {
+			applied[key] = [2]interface{}{oldVal.Interface(), newVal.Interface()}
+		},
+	}
+
+	got := &A{Int: 5, Strings: []string{"a", "b"}, Struct: B{Float: 4.5}}
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][2]interface{}{
+		"int":           {5, 5},
+		"strings":       {[]string{"a", "b"}, []string{"c", "d"}},
+		"struct.float":  {4.5, 5.5},
+		"map.one.float": {0.0, 6.5},
+	}
+	if !reflect.DeepEqual(want, applied) {
+		t.Errorf("applied wrong\nwant: %v\ngot:  %v", want, applied)
+	}
+	if got.Struct.Float != 5.5 || got.Map["one"].Float != 6.5 || !reflect.DeepEqual([]string{"c", "d"}, got.Strings) {
+		t.Error("values were not set:", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+
+	type Errs struct {
+		Int     int        `toml:"int"`
+		Complex complex128 `toml:"complex"`
+		hidden  int        `toml:"hidden"`
+	}
+
+	tests := []struct {
+		Key  string
+		Val  string
+		Want error
+	}{
+		{"int", "five", ErrParse},
+		{"complex", "1+2i", ErrUnsupportedType},
+		{"hidden", "5", ErrUnsettable},
+		{"missing", "5", ErrFieldNotFound},
+		{"int.extra", "5", ErrFieldNotFound},
+	}
+
+	var l Loader
+	for i, test := range tests {
+		err := l.overwriteStructVals("toml", map[string]string{test.Key: test.Val}, new(Errs))
+		if !errors.Is(err, test.Want) {
+			t.Errorf("%d) wrong error, want: %v, got: %v", i, test.Want, err)
+		}
+	}
+
+	if _, err := l.envPseudoKeys("toml", new(int)); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("wrong error for top-level type:", err)
+	}
+
+	err := l.overwriteStructVals("toml", map[string]string{"int": "five"}, new(Errs))
+	if want := `int: parse error: expected int but got value: "five"`; err.Error() != want {
+		t.Errorf("message wrong, want: %s, got: %s", want, err)
+	}
+}
+
+func TestEnvSliceOfMaps(t *testing.T) {
+	type SliceMaps struct {
+		Ints    []map[string]int `toml:"ints"`
+		Structs []map[string]*B  `toml:"structs"`
+	}
+
+	keys := setEnvs(
+		"TEST21_INTS_0_ONE", "1",
+		"TEST21_INTS_1_TWO", "2",
+		"TEST21_STRUCTS_0_ONE_FLOAT", "1.5",
+		"TEST21_STRUCTS_1_TWO_FLOAT", "2.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &SliceMaps{
+		Ints: []map[string]int{{"zero": 0}},
+	}
+	if err := Env("test21", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &SliceMaps{
+		Ints: []map[string]int{
+			{"zero": 0, "one": 1},
+			{"two": 2},
+		},
+		Structs: []map[string]*B{
+			{"one": {Float: 1.5}},
+			{"two": {Float: 2.5}},
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+type Common struct {
+	Name string `toml:"name"`
+	Port int    `toml:"port"`
+}
+
+func TestEnvSquash(t *testing.T) {
+	type Squashed struct {
+		Common `toml:",squash"`
+		Debug  bool `toml:"debug"`
+	}
+
+	keys := setEnvs(
+		"TEST24_NAME", "app",
+		"TEST24_PORT", "80",
+		"TEST24_DEBUG", "true",
+	)
+
+	defer unsetEnvs(keys)
+
+	var l Loader
+	pseudoKeys, err := l.envPseudoKeys("toml", &Squashed{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"name", "port", "debug"}; !reflect.DeepEqual(want, pseudoKeys) {
+		t.Errorf("pseudo keys wrong, want: %v, got: %v", want, pseudoKeys)
+	}
+
+	got := new(Squashed)
+	if err := Env("test24", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "app" || got.Port != 80 || !got.Debug {
+		t.Errorf("fields wrong: %#v", got)
+	}
+
+	// The file would read these from their own key so they can't be
+	// squashed for the env
+	type Named struct {
+		Named struct {
+			Level int `toml:"level"`
+		} `toml:"named,squash"`
+	}
+	type Tagged struct {
+		Common `toml:"common,squash"`
+	}
+	for _, obj := range []interface{}{new(Named), new(Tagged)} {
+		if err := Env("test24", "toml", obj); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%T: expected an error for squash on a named field: %v", obj, err)
+		}
+	}
+}
+
+func TestEnvUnderscorePrefix(t *testing.T) {
+	type Server struct {
+		Server struct {
+			Port int `toml:"port"`
+		} `toml:"server"`
+		App struct {
+			Port int `toml:"port"`
+		} `toml:"app"`
+	}
+
+	keys := setEnvs(
+		"MY_APP_SERVER_PORT", "8080",
+		"MY_APP_APP_PORT", "9090",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Server)
+	if err := Env("my_app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Server.Port != 8080 {
+		t.Error("server port wrong:", got.Server.Port)
+	}
+	if got.App.Port != 9090 {
+		t.Error("app port wrong:", got.App.Port)
+	}
+
+	// The prefix must be matched in full, MY_ alone leaves APP_SERVER_PORT
+	// which isn't a key
+	got = new(Server)
+	if err := Env("my", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Server.Port != 0 {
+		t.Error("server port should not be set:", got.Server.Port)
+	}
+	if got.App.Port != 0 {
+		t.Error("app port should not be set:", got.App.Port)
+	}
+}
+
+func TestEnvNestedMaps(t *testing.T) {
+	type Nested struct {
+		Outer    map[string]*map[string]int `toml:"outer"`
+		OuterVal map[string]map[string]int  `toml:"outerval"`
+	}
+
+	keys := setEnvs(
+		"TEST26_OUTER_A_INNER", "5",
+		"TEST26_OUTER_A_OTHER", "6",
+		"TEST26_OUTERVAL_B_INNER", "7",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Nested)
+	if err := Env("test26", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	inner := map[string]int{"inner": 5, "other": 6}
+	want := &Nested{
+		Outer:    map[string]*map[string]int{"a": &inner},
+		OuterVal: map[string]map[string]int{"b": {"inner": 7}},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvIntLiterals(t *testing.T) {
+	type Ints struct {
+		Mask uint8 `toml:"mask"`
+		Bits int   `toml:"bits"`
+		Big  int64 `toml:"big"`
+		Perm int   `toml:"perm"`
+	}
+
+	keys := setEnvs(
+		"TEST29_MASK", "0xFF",
+		"TEST29_BITS", "0b101",
+		"TEST29_BIG", "1_000_000",
+		"TEST29_PERM", "0o755",
+	)
+
+	defer unsetEnvs(keys)
+
+	if err := Env("test29", "toml", new(Ints)); !errors.Is(err, ErrParse) {
+		t.Error("literals should not parse by default:", err)
+	}
+
+	got := new(Ints)
+	l := Loader{IntLiterals: true}
+	if err := l.Env("test29", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Ints{Mask: 0xFF, Bits: 5, Big: 1000000, Perm: 0755}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvByteSizes(t *testing.T) {
+	type Sizes struct {
+		MaxUpload int64  `toml:"maxupload,bytes"`
+		Cache     uint64 `toml:"cache,bytes"`
+		Plain     int    `toml:"plain,bytes"`
+		Buffer    uint32 `toml:"buffer,bytes"`
+		Bad       int64  `toml:"bad,bytes"`
+	}
+
+	keys := setEnvs(
+		"TEST43_MAXUPLOAD", "10MB",
+		"TEST43_CACHE", "1GiB",
+		"TEST43_PLAIN", "512",
+		"TEST43_BUFFER", "4 kib",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Sizes)
+	if err := Env("test43", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Sizes{
+		MaxUpload: 10000000,
+		Cache:     1 << 30,
+		Plain:     512,
+		Buffer:    4096,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	for _, bad := range []string{"10XB", "MB", "-1KB", "99999999999TiB"} {
+		defer unsetEnvs(setEnvs("TEST43_BAD", bad))
+		if err := Env("test43", "toml", new(Sizes)); !errors.Is(err, ErrParse) {
+			t.Errorf("%s) expected a parse error: %v", bad, err)
+		}
+	}
+}
+
+func TestEnvByteSizesRange(t *testing.T) {
+	t.Parallel()
+
+	type Sizes struct {
+		Small uint16 `toml:"small,bytes"`
+		Mid   int32  `toml:"mid,bytes"`
+	}
+
+	l := Loader{Environ: fakeEnvs("APP_SMALL", "60KiB", "APP_MID", "2GB")}
+	got := new(Sizes)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Small != 61440 || got.Mid != 2000000000 {
+		t.Errorf("sizes wrong: %#v", got)
+	}
+
+	for _, env := range []string{"APP_SMALL=64KiB", "APP_SMALL=1MB", "APP_MID=3GB"} {
+		l.Environ = []string{env}
+		if err := l.Env("app", "toml", new(Sizes)); !errors.Is(err, ErrParse) {
+			t.Errorf("%s: expected an out of range parse error: %v", env, err)
+		}
+	}
+}
+
+func TestEnvMapValueOptions(t *testing.T) {
+	type Limits struct {
+		Timeouts map[string]time.Duration `toml:"timeouts"`
+		Sizes    map[string]int64         `toml:"sizes,bytes"`
+		Uploads  []uint64                 `toml:"uploads,bytes"`
+	}
+
+	keys := setEnvs(
+		"TEST61_TIMEOUTS_READ", "5s",
+		"TEST61_TIMEOUTS_WRITE", "1m30s",
+		"TEST61_SIZES_BODY", "10MB",
+		"TEST61_SIZES_HEADER", "4KiB",
+		"TEST61_UPLOADS", "1KB,2MiB",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Limits)
+	if err := Env("test61", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Limits{
+		Timeouts: map[string]time.Duration{"read": 5 * time.Second, "write": 90 * time.Second},
+		Sizes:    map[string]int64{"body": 10000000, "header": 4096},
+		Uploads:  []uint64{1000, 2 << 20},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvFloats(t *testing.T) {
+	type Floats struct {
+		Ratio    float64   `toml:"ratio,percent"`
+		Ratios   []float32 `toml:"ratios,percent"`
+		Plain    float64   `toml:"plain,percent"`
+		Sci      float64   `toml:"sci"`
+		Inf      float64   `toml:"inf"`
+		NotRatio float64   `toml:"notratio"`
+	}
+
+	keys := setEnvs(
+		"TEST30_RATIO", "50%",
+		"TEST30_RATIOS", "25%,0.5",
+		"TEST30_PLAIN", "0.25",
+		"TEST30_SCI", "1.5e3",
+		"TEST30_INF", "Inf",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Floats)
+	if err := Env("test30", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Floats{
+		Ratio:  0.5,
+		Ratios: []float32{0.25, 0.5},
+		Plain:  0.25,
+		Sci:    1500,
+		Inf:    math.Inf(1),
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	defer unsetEnvs(setEnvs("TEST30_NOTRATIO", "50%"))
+
+	if err := Env("test30", "toml", got); !errors.Is(err, ErrParse) {
+		t.Error("percentages should only be allowed with the percent option:", err)
+	}
+}
+
+func TestEnvFloat32Range(t *testing.T) {
+	t.Parallel()
+
+	type Floats struct {
+		Small float32 `toml:"small"`
+		Big   float64 `toml:"big"`
+		Inf   float32 `toml:"inf"`
+	}
+
+	l := Loader{Environ: fakeEnvs("APP_SMALL", "1.5", "APP_BIG", "1e300", "APP_INF", "-Inf")}
+	got := new(Floats)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Small != 1.5 || got.Big != 1e300 || !math.IsInf(float64(got.Inf), -1) {
+		t.Errorf("floats wrong: %#v", got)
+	}
+
+	for _, env := range []string{"APP_SMALL=1e300", "APP_SMALL=-1e39", "APP_BIG=1e400"} {
+		l.Environ = []string{env}
+		if err := l.Env("app", "toml", new(Floats)); !errors.Is(err, ErrParse) {
+			t.Errorf("%s: expected an out of range parse error: %v", env, err)
+		}
+	}
+}
+
+func TestEnvDecimalComma(t *testing.T) {
+	t.Parallel()
+
+	type Floats struct {
+		Scalar float64   `toml:"scalar"`
+		Ratio  float64   `toml:"ratio,percent"`
+		Dotted float64   `toml:"dotted"`
+		List   []float64 `toml:"list"`
+		Quoted []float64 `toml:"quoted"`
+		Semi   []float32 `toml:"semi,sep=;"`
+	}
+
+	l := Loader{
+		DecimalComma: true,
+		Environ: fakeEnvs(
+			"APP_SCALAR", "4,5",
+			"APP_RATIO", "12,5%",
+			"APP_DOTTED", "1.5",
+			// Lists are split on commas before the floats are parsed
+			"APP_LIST", "4,5",
+			"APP_QUOTED", `"4,5","1,5"`,
+			"APP_SEMI", "0,25;0,5",
+		),
+	}
+
+	got := new(Floats)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Floats{
+		Scalar: 4.5,
+		Ratio:  0.125,
+		Dotted: 1.5,
+		List:   []float64{4, 5},
+		Quoted: []float64{4.5, 1.5},
+		Semi:   []float32{0.25, 0.5},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	l.DecimalComma = false
+	l.Environ = fakeEnvs("APP_SCALAR", "4,5")
+	if err := l.Env("app", "toml", new(Floats)); !errors.Is(err, ErrParse) {
+		t.Error("commas should only be allowed with DecimalComma:", err)
+	}
+}
+
+func TestEnvIntBool(t *testing.T) {
+	type Flags struct {
+		Enabled  int  `toml:"enabled,intbool"`
+		Disabled int  `toml:"disabled,intbool"`
+		Number   int8 `toml:"number,intbool"`
+		Unsigned uint `toml:"unsigned,intbool"`
+		UFalse   uint `toml:"ufalse,intbool"`
+		Plain    int  `toml:"plain"`
+	}
+
+	keys := setEnvs(
+		"TEST73_ENABLED", "true",
+		"TEST73_DISABLED", "false",
+		"TEST73_NUMBER", "1",
+		"TEST73_UNSIGNED", "TRUE",
+		"TEST73_UFALSE", "false",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &Flags{Disabled: 5, UFalse: 5}
+	if err := Env("test73", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (&Flags{Enabled: 1, Number: 1, Unsigned: 1}); !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+
+	defer unsetEnvs(setEnvs("TEST73_PLAIN", "true"))
+
+	if err := Env("test73", "toml", got); !errors.Is(err, ErrParse) {
+		t.Error("bools should only be allowed with the intbool option:", err)
+	}
+}
+
+func TestEnvAlias(t *testing.T) {
+	type Aliased struct {
+		DB    string `toml:"db,envalias=DATABASE_URL|DB_DSN"`
+		Cache struct {
+			URL string `toml:"url,envalias=REDIS_URL"`
+		} `toml:"cache"`
+		Queue string `toml:"queue,envalias=AMQP_URL"`
+	}
+
+	keys := setEnvs(
+		"TEST31_DB_DSN", "dsn",
+		"TEST31_REDIS_URL", "redis://",
+		"TEST31_QUEUE", "direct",
+		"TEST31_AMQP_URL", "amqp://",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Aliased)
+	if err := Env("test31", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.DB != "dsn" {
+		t.Error("db wrong:", got.DB)
+	}
+	if got.Cache.URL != "redis://" {
+		t.Error("cache url wrong:", got.Cache.URL)
+	}
+	if got.Queue != "direct" {
+		t.Error("the field's own name should win over an alias:", got.Queue)
+	}
+
+	defer unsetEnvs(setEnvs("TEST31_DATABASE_URL", "url"))
+
+	if err := Env("test31", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.DB != "url" {
+		t.Error("the first alias should win:", got.DB)
+	}
+}
+
+func TestEnvAliasContainers(t *testing.T) {
+	t.Parallel()
+
+	type Inner struct {
+		A int `toml:"a"`
+	}
+	type Aliased struct {
+		S    Inner          `toml:"s,envalias=ALT"`
+		M    map[string]int `toml:"m,envalias=ALTMAP"`
+		JSON Inner          `toml:"json,json,envalias=ALTJSON"`
+	}
+
+	l := Loader{Environ: fakeEnvs("P_ALT", "1", "P_ALTMAP", "2", "P_ALTJSON", `{"A":3}`)}
+	got := new(Aliased)
+	if err := l.Env("p", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.S.A != 0 || got.M != nil {
+		t.Errorf("aliases on containers should be ignored: %#v", got)
+	}
+	if got.JSON.A != 3 {
+		t.Error("json structs should be set by an alias:", got.JSON.A)
+	}
+
+	err := l.overwriteStructVals("toml", map[string]string{"s": "1"}, got)
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Error("expected an unsupported type error setting a struct from one value:", err)
+	}
+}
+
+func TestEnvFiles(t *testing.T) {
+	type Secrets struct {
+		Password string `toml:"password"`
+		Token    string `toml:"token"`
+	}
+
+	keys := setEnvs(
+		"TEST34_PASSWORD_FILE", "testdata/password.txt",
+		"TEST34_TOKEN", "plain",
+		"TEST34_TOKEN_FILE", "testdata/password.txt",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Secrets)
+	if err := Env("test34", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != "" {
+		t.Error("files should not be read by default:", got.Password)
+	}
+
+	l := Loader{FileEnvSuffix: "_FILE"}
+	if err := l.Env("test34", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Password != "hunter2" {
+		t.Error("password wrong:", got.Password)
+	}
+	if got.Token != "plain" {
+		t.Error("token should prefer the plain value:", got.Token)
+	}
+
+	l.PreferFileEnv = true
+	if err := l.Env("test34", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Token != "hunter2" {
+		t.Error("token should prefer the file:", got.Token)
+	}
+
+	defer unsetEnvs(setEnvs("TEST34_PASSWORD_FILE", "testdata/missing.txt"))
+
+	if err := l.Env("test34", "toml", got); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestEnvAllowedKeys(t *testing.T) {
+	keys := setEnvs(
+		"TEST35_INT", "5",
+		"TEST35_STRUCT_FLOAT", "5.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(A)
+	l := Loader{AllowedKeys: []string{"TEST35_INT"}}
+	if err := l.Env("test35", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if got.Struct.Float != 0 {
+		t.Error("struct float is not allowed:", got.Struct.Float)
+	}
+
+	// An empty but non-nil list allows nothing
+	got = new(A)
+	l.AllowedKeys = []string{}
+	if err := l.Env("test35", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Int != 0 {
+		t.Error("int is not allowed:", got.Int)
+	}
+}
+
+func TestEnvSecretRedacted(t *testing.T) {
+	t.Parallel()
+
+	type Secret struct {
+		Token  int            `toml:"token,secret"`
+		Tokens map[string]int `toml:"tokens,secret"`
+	}
+
+	var l Loader
+	for _, key := range []string{"token", "tokens.one"} {
+		err := l.overwriteStructVals("toml", map[string]string{key: "s3cr3t"}, new(Secret))
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if strings.Contains(err.Error(), "s3cr3t") {
+			t.Error("secret was leaked:", err)
+		}
+		if want := key + `: parse error: expected int but got value: "***"`; err.Error() != want {
+			t.Errorf("message wrong, want: %s, got: %s", want, err)
+		}
+	}
+}
+
+func TestEnvNegatable(t *testing.T) {
+	type Features struct {
+		Cache    bool `toml:"cache,negatable"`
+		Compress bool `toml:"compress,negatable"`
+		Nested   struct {
+			Log bool `toml:"log,negatable"`
+		} `toml:"nested"`
+	}
+
+	keys := setEnvs(
+		"TEST36_NO_CACHE", "1",
+		"TEST36_COMPRESS", "true",
+		"TEST36_NO_COMPRESS", "true",
+		"TEST36_NESTED_NO_LOG", "false",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &Features{Cache: true}
+	if err := Env("test36", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Cache {
+		t.Error("cache should be disabled")
+	}
+	if got.Compress {
+		t.Error("the NO_ form should win when both are set")
+	}
+	if !got.Nested.Log {
+		t.Error("nested log should be enabled")
+	}
+
+	defer unsetEnvs(setEnvs("TEST36_NO_CACHE", "nope"))
+
+	if err := Env("test36", "toml", got); !errors.Is(err, ErrParse) {
+		t.Error("expected a parse error:", err)
+	}
+}
+
+func TestEnvNegatableOrder(t *testing.T) {
+	t.Parallel()
+
+	// zap sorts after no_zap and abc before no_abc, the NO_ form wins both
+	type Features struct {
+		Abc    bool `toml:"abc,negatable"`
+		Zap    bool `toml:"zap,negatable"`
+		Nested struct {
+			Zap bool `toml:"zap,negatable"`
+		} `toml:"nested"`
+	}
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_ABC", "true",
+		"APP_NO_ABC", "true",
+		"APP_ZAP", "true",
+		"APP_NO_ZAP", "true",
+		"APP_NESTED_ZAP", "true",
+		"APP_NESTED_NO_ZAP", "true",
+	)}
+
+	got := new(Features)
+	if err := l.Env("app", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Abc || got.Zap || got.Nested.Zap {
+		t.Errorf("the NO_ form should win: %#v", got)
+	}
+}
+
+func TestEnvNameMapper(t *testing.T) {
+	type Mapped struct {
+		Server struct {
+			Port int `toml:"port"`
+		} `toml:"server"`
+		HTTPPort int          `toml:"http_port"`
+		Map      map[string]B `toml:"map"`
+	}
+
+	keys := setEnvs(
+		"TEST37_SERVER__PORT", "80",
+		"TEST37_SERVER_PORT", "81",
+		"TEST37_HTTP_PORT", "82",
+		"TEST37_MAP_ONE_FLOAT", "1.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	l := Loader{
+		NameMapper: func(path []string) string {
+			return strings.ToUpper(strings.Join(path, "__"))
+		},
+	}
+
+	got := new(Mapped)
+	if err := l.Env("test37", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Server.Port != 80 {
+		t.Error("server port wrong:", got.Server.Port)
+	}
+	if got.HTTPPort != 82 {
+		t.Error("http port wrong:", got.HTTPPort)
+	}
+	if got.Map["one"].Float != 1.5 {
+		t.Error("map should use the default naming:", got.Map)
+	}
+}
+
+func TestNonStructs(t *testing.T) {
+	t.Parallel()
+
+	var l Loader
+	obj := make(map[string]int)
+
+	err := l.overwriteStructVals("", map[string]string{"one": "1"}, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj["one"] != 1 {
+		t.Error("expected a value to be set")
+	}
+
+	sliceObj := make([]B, 0, 0)
+	err = l.overwriteStructVals("toml", map[string]string{"0.float": "1.0"}, &sliceObj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sliceObj[0].Float != 1.0 {
+		t.Error("slice not set correctly")
+	}
+}
+
+func TestTopLevelStructMap(t *testing.T) {
+	var l Loader
+	obj := make(map[string]B)
+
+	keys, err := l.envPseudoKeys("toml", obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"*.float"}; !reflect.DeepEqual(want, keys) {
+		t.Errorf("pseudo keys wrong, want: %v, got: %v", want, keys)
+	}
+
+	err = l.overwriteStructVals("toml", map[string]string{"one.float": "1.5", "two.float": "2.5"}, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj["one"].Float != 1.5 || obj["two"].Float != 2.5 {
+		t.Error("map not set correctly:", obj)
+	}
+
+	envKeys := setEnvs("TEST18_THREE_FLOAT", "3.5")
+
+	defer unsetEnvs(envKeys)
+
+	if err = Env("test18", "toml", obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj["three"].Float != 3.5 {
+		t.Error("map not set correctly from env:", obj)
+	}
+}
+
+func TestNonPointerStruct(t *testing.T) {
+	t.Parallel()
+
+	var l Loader
+	err := l.overwriteStructVals("toml", map[string]string{"int": "5"}, A{})
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatal("wrong error:", err)
+	}
+	if want := "type not supported: obj must be a pointer to struct/map/slice but got: loadcfg.A"; err.Error() != want {
+		t.Errorf("message wrong, want: %s, got: %s", want, err)
+	}
+
+	// Even with no env vars set it's still an error
+	if err := Env("test28", "toml", A{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("wrong error:", err)
+	}
+
+	if err := Env("test28", "toml", (*A)(nil)); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("wrong error for nil pointer:", err)
+	}
+}
+
+func TestTopLevelContainers(t *testing.T) {
+	t.Parallel()
+
+	var l Loader
+	values := map[string]string{"0.float": "1.5", "2.float": "2.5"}
+
+	sliceObj := []B{{Float: 0.5}}
+	if err := l.overwriteStructVals("toml", values, sliceObj); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("expected an error for a slice passed by value:", err)
+	}
+
+	if err := l.overwriteStructVals("toml", values, &sliceObj); err != nil {
+		t.Fatal(err)
+	}
+	if want := []B{{Float: 1.5}, {}, {Float: 2.5}}; !reflect.DeepEqual(want, sliceObj) {
+		t.Errorf("slice wrong, want: %v, got: %v", want, sliceObj)
+	}
+
+	mapValues := map[string]string{"one": "1"}
+	mapObj := make(map[string]int)
+	if err := l.overwriteStructVals("", mapValues, mapObj); err != nil {
+		t.Fatal(err)
+	}
+	var mapPtrObj map[string]int
+	if err := l.overwriteStructVals("", mapValues, &mapPtrObj); err != nil {
+		t.Fatal(err)
+	}
+	if mapObj["one"] != 1 || mapPtrObj["one"] != 1 {
+		t.Error("maps not set correctly:", mapObj, mapPtrObj)
+	}
+}
+
+func TestTopLevelNilMapPointer(t *testing.T) {
+	keys := setEnvs(
+		"TEST72_ONE_FLOAT", "1.5",
+		"TEST72_TWO_FLOAT", "2.5",
+	)
+
+	defer unsetEnvs(keys)
+
+	var structs map[string]B
+	if err := Env("test72", "toml", &structs); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]B{"one": {Float: 1.5}, "two": {Float: 2.5}}; !reflect.DeepEqual(want, structs) {
+		t.Errorf("map wrong, want: %v, got: %v", want, structs)
+	}
+
+	var ptrs map[string]*B
+	if err := Env("test72", "toml", &ptrs); err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 2 || ptrs["one"].Float != 1.5 || ptrs["two"].Float != 2.5 {
+		t.Error("map of pointers wrong:", ptrs)
+	}
+
+	// There's nowhere to put the map if the pointer itself is nil
+	if err := Env("test72", "toml", (*map[string]B)(nil)); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("expected an error for a nil pointer:", err)
+	}
+}
+
+func TestSliceIndexGaps(t *testing.T) {
+	t.Parallel()
+
+	var l Loader
+	pseudoKeys, err := l.envPseudoKeys("toml", &A{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orders := [][]string{
+		fakeEnvs("X_SLICE_0_FLOAT", "1.5", "X_SLICE_2_FLOAT", "2.5"),
+		fakeEnvs("X_SLICE_2_FLOAT", "2.5", "X_SLICE_0_FLOAT", "1.5"),
+	}
+
+	for i, envs := range orders {
+		got := new(A)
+		kvs := l.findKeyValues(envs, "x", pseudoKeys)
+		if err := l.overwriteStructVals("toml", kvs, got); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []B{{Float: 1.5}, {}, {Float: 2.5}}; !reflect.DeepEqual(want, got.Slice) {
+			t.Errorf("%d) slice wrong, want: %v, got: %v", i, want, got.Slice)
+		}
+	}
+}
+
+func TestStrictSliceIndex(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		Strict bool
+		Values map[string]string
+		Len    int
+		Err    bool
+	}{
+		{false, map[string]string{"slice.5.float": "1.5"}, 6, false},
+		{true, map[string]string{"slice.5.float": "1.5"}, 2, true},
+		{true, map[string]string{"slice.1.float": "1.5"}, 2, false},
+		{true, map[string]string{"slice.2.float": "1.5", "slice.3.float": "1.5"}, 4, false},
+	}
+
+	for i, test := range tests {
+		l := Loader{StrictSliceIndex: test.Strict}
+		got := &A{Slice: []B{{Float: 0.5}, {Float: 0.5}}}
+
+		err := l.overwriteStructVals("toml", test.Values, got)
+		if test.Err != (err != nil) {
+			t.Errorf("%d) error wrong: %v", i, err)
+		}
+		if test.Err && !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("%d) wrong error: %v", i, err)
+		}
+		if len(got.Slice) != test.Len {
+			t.Errorf("%d) length wrong, want: %d, got: %d", i, test.Len, len(got.Slice))
+		}
+		if got.Slice[0].Float != 0.5 {
+			t.Errorf("%d) file values should not be zeroed: %v", i, got.Slice)
+		}
+	}
+}
+
+func TestLessKey(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{
+		"slice.10.float",
+		"slice.2.float",
+		"map.b",
+		"slice.0.float",
+		"map.a",
+		"slice",
+		"map.10",
+		"map.9",
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+
+	want := []string{
+		"map.9",
+		"map.10",
+		"map.a",
+		"map.b",
+		"slice",
+		"slice.0.float",
+		"slice.2.float",
+		"slice.10.float",
+	}
+	if !reflect.DeepEqual(want, keys) {
+		t.Errorf("order wrong\nwant: %v\ngot:  %v", want, keys)
+	}
+
+	// Numbers, names and appends are each ordered as a group so the order
+	// is the same whatever order the keys start in
+	mixed := []string{"10", "1a", "2", "+", "b", "01", "1", "-1"}
+	want = []string{"01", "1", "2", "10", "1a", "b", "+", "-1"}
+	for i := range mixed {
+		rotated := append(append([]string(nil), mixed[i:]...), mixed[:i]...)
+		sort.Slice(rotated, func(i, j int) bool { return lessKey(rotated[i], rotated[j]) })
+		if !reflect.DeepEqual(want, rotated) {
+			t.Fatalf("mixed order wrong\nwant: %v\ngot:  %v", want, rotated)
+		}
+	}
+	for _, x := range mixed {
+		for _, y := range mixed {
+			for _, z := range mixed {
+				if lessKey(x, y) && lessKey(y, z) && !lessKey(x, z) {
+					t.Errorf("not transitive: %s < %s < %s", x, y, z)
+				}
+			}
+		}
+	}
+}
+
+func TestSliceIndexNumericOrder(t *testing.T) {
+	t.Parallel()
+
+	var applied []string
+	l := Loader{OnChange: func(key string) { applied = append(applied, key) }}
+
+	got := new(A)
+	values := map[string]string{
+		"slice.0.float":  "1.5",
+		"slice.2.float":  "2.5",
+		"slice.10.float": "3.5",
+	}
+	if err := l.overwriteStructVals("toml", values, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Slice) != 11 {
+		t.Fatal("slice length wrong:", len(got.Slice))
+	}
+	if got.Slice[0].Float != 1.5 || got.Slice[2].Float != 2.5 || got.Slice[10].Float != 3.5 {
+		t.Error("slice values wrong:", got.Slice)
+	}
+	if want := []string{"slice.0.float", "slice.2.float", "slice.10.float"}; !reflect.DeepEqual(want, applied) {
+		t.Errorf("applied in wrong order, want: %v, got: %v", want, applied)
+	}
+}
+
+func TestSliceMaxLen(t *testing.T) {
+	t.Parallel()
+
+	type Limited struct {
+		Slice []B   `toml:"slice,maxlen=2"`
+		Ints  []int `toml:"ints,maxlen=3"`
+		Bad   []int `toml:"bad,maxlen=x"`
+	}
+
+	tests := []struct {
+		values map[string]string
+		err    error
+	}{
+		{map[string]string{"slice.1.float": "1.5", "ints": "1,2,3", "ints.2": "4"}, nil},
+		{map[string]string{"slice.2.float": "1.5"}, ErrIndexOutOfRange},
+		{map[string]string{"slice.1000000.float": "1.5"}, ErrIndexOutOfRange},
+		{map[string]string{"slice.0.float": "1", "slice.1.float": "2", "slice.+.float": "3"}, ErrIndexOutOfRange},
+		{map[string]string{"ints": "1,2,3,4"}, ErrIndexOutOfRange},
+		{map[string]string{"bad.0": "1"}, ErrParse},
+	}
+
+	for i, test := range tests {
+		var l Loader
+		err := l.overwriteStructVals("toml", test.values, new(Limited))
+		if test.err == nil && err != nil {
+			t.Errorf("%d) unexpected error: %v", i, err)
+		} else if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("%d) expected %v but got: %v", i, test.err, err)
+		}
+	}
+}
+
+func TestMaxSliceIndex(t *testing.T) {
+	t.Parallel()
+
+	var l Loader
+	got := new(A)
+	err := l.overwriteStructVals("toml", map[string]string{"slice.2000000000.float": "1.5"}, got)
+	if !errors.Is(err, ErrIndexOutOfRange) {
+		t.Error("expected an absurd index to be rejected:", err)
+	}
+	if len(got.Slice) != 0 {
+		t.Error("slice should not have grown:", len(got.Slice))
+	}
+
+	if err := l.overwriteStructVals("toml", map[string]string{"slice.10000.float": "1.5"}, new(A)); err != nil {
+		t.Error("the default max index should be allowed:", err)
+	}
+
+	l.MaxSliceIndex = 5
+	if err := l.overwriteStructVals("toml", map[string]string{"slice.6.float": "1.5"}, new(A)); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Error("expected the configured max to be used:", err)
+	}
+
+	l.MaxSliceIndex = -1
+	if err := l.overwriteStructVals("toml", map[string]string{"slice.10001.float": "1.5"}, new(A)); err != nil {
+		t.Error("a negative max should remove the limit:", err)
+	}
+}
+
+func TestSliceAppend(t *testing.T) {
+	keys := setEnvs(
+		"TEST46_SLICE_+_FLOAT", "6.5",
+		"TEST46_SLICEPTR_-1_FLOAT", "7.5",
+		"TEST46_STRINGS_+", "three",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &A{Strings: []string{"one", "two"}}
+	if _, err := TOML("test46", "testdata/one.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading again appends another element
+	defer unsetEnvs(setEnvs("TEST46_SLICE_+_FLOAT", "8.5"))
+	if err := Env("test46", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	floats := make([]float64, len(got.Slice))
+	for i, b := range got.Slice {
+		floats[i] = b.Float
+	}
+	if want := []float64{4.5, 4.5, 6.5, 8.5}; !reflect.DeepEqual(want, floats) {
+		t.Errorf("slice wrong, want: %v, got: %v", want, floats)
+	}
+	if n := len(got.SlicePtr); n != 4 || got.SlicePtr[2].Float != 7.5 || got.SlicePtr[3].Float != 7.5 {
+		t.Error("sliceptr wrong:", got.SlicePtr)
+	}
+	if want := []string{"one", "two", "three", "three"}; !reflect.DeepEqual(want, got.Strings) {
+		t.Errorf("strings wrong, want: %v, got: %v", want, got.Strings)
+	}
+}
+
+func TestSliceAppendSharesElement(t *testing.T) {
+	t.Parallel()
+
+	type Server struct {
+		Host string `toml:"host"`
+		Port int    `toml:"port"`
+	}
+	type Servers struct {
+		Servers []Server `toml:"servers"`
+	}
+
+	envs := fakeEnvs(
+		"APP_SERVERS_0_HOST", "a",
+		"APP_SERVERS_+_HOST", "b",
+		"APP_SERVERS_+_PORT", "80",
+	)
+
+	var l Loader
+	got := new(Servers)
+	pseudoKeys, err := l.envPseudoKeys("toml", got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.overwriteStructVals("toml", l.findKeyValues(envs, "app", pseudoKeys), got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Servers{Servers: []Server{{Host: "a"}, {Host: "b", Port: 80}}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestSliceNamedElements(t *testing.T) {
+	type Server struct {
+		Name string `toml:"name,key"`
+		Port int    `toml:"port"`
+	}
+	type Servers struct {
+		Servers []Server  `toml:"servers"`
+		Ptrs    []*Server `toml:"ptrs"`
+	}
+
+	keys := setEnvs(
+		"TEST47_SERVERS_WEB_PORT", "80",
+		"TEST47_SERVERS_api_PORT", "443",
+		"TEST47_SERVERS_DB_PORT", "5432",
+		"TEST47_SERVERS_1_NAME", "API",
+		"TEST47_PTRS_CACHE_PORT", "6379",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(Servers)
+	if _, err := TOML("test47", "testdata/servers.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file's elements are matched by name and a missing one is appended
+	want := []Server{{Name: "web", Port: 80}, {Name: "API", Port: 443}, {Name: "db", Port: 5432}}
+	if !reflect.DeepEqual(want, got.Servers) {
+		t.Errorf("servers wrong, want: %v, got: %v", want, got.Servers)
+	}
+	if len(got.Ptrs) != 1 || *got.Ptrs[0] != (Server{Name: "cache", Port: 6379}) {
+		t.Error("ptrs wrong:", got.Ptrs)
+	}
+}
+
+func TestConcurrentLoads(t *testing.T) {
+	type Server struct {
+		Port  int               `toml:"port"`
+		Hosts []string          `toml:"hosts"`
+		Tags  map[string]string `toml:"tags"`
+	}
+	type Database struct {
+		URL     string        `toml:"url"`
+		Timeout time.Duration `toml:"timeout"`
+	}
+
+	keys := setEnvs(
+		"TEST50_PORT", "8080",
+		"TEST50_HOSTS", "a,b",
+		"TEST50_TAGS_ENV", "prod",
+		"TEST51_URL", "postgres://localhost",
+		"TEST51_TIMEOUT", "5s",
+	)
+
+	defer unsetEnvs(keys)
+
+	wantServer := Server{Port: 8080, Hosts: []string{"a", "b"}, Tags: map[string]string{"env": "prod"}}
+	wantDatabase := Database{URL: "postgres://localhost", Timeout: 5 * time.Second}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			got := new(Server)
+			if _, err := TOML("test50", "testdata/missing.toml", got); err != nil {
+				errs <- err
+			} else if !reflect.DeepEqual(wantServer, *got) {
+				errs <- fmt.Errorf("server wrong: %v", *got)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			got := new(Database)
+			if err := Env("test51", "toml", got); err != nil {
+				errs <- err
+			} else if wantDatabase != *got {
+				errs <- fmt.Errorf("database wrong: %v", *got)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestFindKeyValuesUnicode(t *testing.T) {
+	t.Parallel()
+
+	type Unicode struct {
+		ID  string            `toml:"ıd"`
+		Map map[string]string `toml:"map"`
+	}
+
+	envs := fakeEnvs(
+		"APP_ıD", "dotless",
+		"APP_ID", "ascii",
+		"APP_MAP_İSTANBUL", "city",
+		"APP_MAP_ıX", "mixed",
+	)
+
+	for _, ignoreCase := range []bool{false, true} {
+		l := Loader{IgnoreCase: ignoreCase}
+		pseudoKeys, err := l.envPseudoKeys("toml", &Unicode{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Only ASCII letters are folded so the dotless i is never confused
+		// with I and characters in map keys are kept whole
+		want := map[string]string{
+			"ıd":           "dotless",
+			"map.İstanbul": "city",
+			"map.ıx":       "mixed",
+		}
+		if got := l.findKeyValues(envs, "app", pseudoKeys); !reflect.DeepEqual(want, got) {
+			t.Errorf("ignorecase %t) values wrong, want: %v, got: %v", ignoreCase, want, got)
+		}
+	}
+}
+
+func TestEnvMixedCaseTag(t *testing.T) {
+	type Mixed struct {
+		API    string            `toml:"aPi"`
+		Nested map[string]string `toml:"neSted"`
+	}
+
+	keys := setEnvs(
+		"TEST66_API", "key",
+		"TEST66_NESTED_ONE", "1",
+	)
+
+	defer unsetEnvs(keys)
+
+	var l Loader
+	pseudoKeys, err := l.envPseudoKeys("toml", &Mixed{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tag's casing is kept in the key
+	want := map[string]string{"aPi": "key", "neSted.one": "1"}
+	if got := l.findKeyValues(os.Environ(), "test66", pseudoKeys); !reflect.DeepEqual(want, got) {
+		t.Errorf("values wrong, want: %v, got: %v", want, got)
+	}
+
+	got := new(Mixed)
+	if err := Env("test66", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.API != "key" || got.Nested["one"] != "1" {
+		t.Error("values wrong:", got.API, got.Nested)
 	}
 }
 
@@ -360,7 +4002,8 @@ func TestFindKeyValues(t *testing.T) {
 		"X_ARR_1_VAR1", "var11",
 	)
 
-	kvs := findKeyValues(envs, "x", []string{
+	var l Loader
+	kvs := l.findKeyValues(envs, "x", []string{
 		"array",
 		"multi.sep",
 		"int",
@@ -407,10 +4050,13 @@ func TestCompareWildcardEnvs(t *testing.T) {
 		{"HELLO_THERE_FRIEND", "hello.#.friend", "", false},
 		{"HELLO_THERE_GUY_FRIEND", "hello.*.friend", "", false},
 		{"HELLO_THERE_FRIEND", "hello.there.friend", "hello.there.friend", true},
+		{"HELLO_5", "hello.#", "hello.5", true},
+		{"HELLO_", "hello.#", "", false},
 	}
 
+	var l Loader
 	for i, test := range tests {
-		out, matched := compareWildcardEnvs(test.Env, test.Pkey)
+		out, matched := l.compareWildcardEnvs(test.Env, test.Pkey)
 		if test.Match != matched {
 			t.Errorf("%d) matched wrong, want: %t, got: %t", i, test.Match, matched)
 		} else if matched && test.Out != out {
@@ -425,6 +4071,7 @@ func TestEnvPseudoKeys(t *testing.T) {
 	required := []string{
 		"int",
 		"strings",
+		"strings.#",
 		"embedded.int",
 
 		"map.*.float",
@@ -437,7 +4084,8 @@ func TestEnvPseudoKeys(t *testing.T) {
 		"structptr.float",
 	}
 
-	keys, err := envPseudoKeys("toml", &A{})
+	var l Loader
+	keys, err := l.envPseudoKeys("toml", &A{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,108 @@
+package loadcfg
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Options holds everything that configures a single load: the Loader's
+// options along with the arguments that are otherwise passed to each call.
+type Options struct {
+	Loader
+
+	// Prefix is the env var prefix, eg. APP for APP_PORT
+	Prefix string
+	// Tag is the struct tag used by EnvOpts, it defaults to "toml". TOMLOpts
+	// always uses the toml tag.
+	Tag string
+	// RequireFile makes a missing config file an error instead of loading
+	// only the env.
+	RequireFile bool
+}
+
+// TOMLOpts is the same as TOML but is configured entirely by opts.
+func TOMLOpts(filename string, obj interface{}, opts Options) (toml.MetaData, error) {
+	if opts.RequireFile {
+		if _, err := os.Stat(opts.configFile(opts.Prefix, filename)); err != nil {
+			return toml.MetaData{}, err
+		}
+	}
+
+	return opts.Loader.TOML(opts.Prefix, filename, obj)
+}
+
+// EnvOpts is the same as Env but is configured entirely by opts.
+func EnvOpts(obj interface{}, opts Options) error {
+	tag := opts.Tag
+	if len(tag) == 0 {
+		tag = "toml"
+	}
+
+	return opts.Loader.Env(opts.Prefix, tag, obj)
+}
+
+// EnvAnnotated is the same as Env but the prefix and tag come from obj's
+// type, which must have a blank field annotated with them:
+//
+//	type Config struct {
+//	    _    struct{} `loadcfg:"prefix=APP,tag=toml"`
+//	    Port int      `toml:"port"`
+//	}
+//
+// The tag defaults to "toml" if it's left out.
+func EnvAnnotated(obj interface{}) error {
+	var l Loader
+	return l.EnvAnnotated(obj)
+}
+
+// EnvAnnotated is the same as the package level EnvAnnotated but uses the
+// Loader's options.
+func (l *Loader) EnvAnnotated(obj interface{}) error {
+	opts, err := annotatedOptions(reflect.TypeOf(obj))
+	if err != nil {
+		return err
+	}
+
+	opts.Loader = *l
+	return EnvOpts(obj, opts)
+}
+
+// annotatedOptions reads the prefix and tag from the loadcfg tag on a blank
+// field of typ
+func annotatedOptions(typ reflect.Type) (Options, error) {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return Options{}, fmt.Errorf("%w: annotations must be on a struct but got: %v", ErrUnsupportedType, typ)
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		annotation, ok := field.Tag.Lookup("loadcfg")
+		if field.Name != "_" || !ok {
+			continue
+		}
+
+		var opts Options
+		for _, opt := range strings.Split(annotation, ",") {
+			key, val, _ := strings.Cut(opt, "=")
+			switch key {
+			case "prefix":
+				opts.Prefix = val
+			case "tag":
+				opts.Tag = val
+			default:
+				return Options{}, fmt.Errorf("%w: unknown annotation on %s: %s", ErrParse, typ.String(), opt)
+			}
+		}
+
+		return opts, nil
+	}
+
+	return Options{}, fmt.Errorf("%w: %s has no loadcfg annotation", ErrFieldNotFound, typ.String())
+}
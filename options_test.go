@@ -0,0 +1,172 @@
+package loadcfg
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestTOMLOpts(t *testing.T) {
+	t.Parallel()
+
+	opts := Options{
+		Loader: Loader{
+			Environ:          []string{"APP_INT=6", "APP_SLICE_+_FLOAT=5.5", "APP_CONFIG=testdata/one.toml"},
+			ConfigFileEnv:    "CONFIG",
+			StrictSliceIndex: true,
+		},
+		Prefix:      "app",
+		RequireFile: true,
+	}
+
+	// The file comes from the config env var in Environ
+	got := new(A)
+	if _, err := TOMLOpts("testdata/missing.toml", got, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 6 {
+		t.Error("int wrong:", got.Int)
+	}
+	if len(got.Slice) != 3 || got.Slice[2].Float != 5.5 {
+		t.Error("slice wrong:", got.Slice)
+	}
+	if len(got.Map) != 2 {
+		t.Error("file not loaded:", got.Map)
+	}
+
+	opts.Environ = []string{"APP_INT=6"}
+	if _, err := TOMLOpts("testdata/missing.toml", new(A), opts); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected the required file to be missing:", err)
+	}
+
+	opts.RequireFile = false
+	if _, err := TOMLOpts("testdata/missing.toml", new(A), opts); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnvOpts(t *testing.T) {
+	t.Parallel()
+
+	type Tagged struct {
+		Port  int      `env:"port"`
+		Hosts []string `env:"hosts"`
+	}
+
+	opts := Options{
+		Loader: Loader{
+			Environ:    []string{"app_port=8080", "APP_HOSTS='a','b'", "OTHER_PORT=1"},
+			IgnoreCase: true,
+			TrimQuotes: "'",
+		},
+		Prefix: "app",
+		Tag:    "env",
+	}
+
+	got := new(Tagged)
+	if err := EnvOpts(got, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (&Tagged{Port: 8080, Hosts: []string{"a", "b"}}); !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+func TestEnvOptsSeparators(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		HTTPPort int          `toml:"http_port"`
+		Server   B            `toml:"server"`
+		Map      map[string]B `toml:"map"`
+		Slice    []B          `toml:"slice"`
+		Name     string       `toml:"name"`
+	}
+
+	opts := Options{
+		Loader: Loader{
+			Environ: []string{
+				"APP__HTTP_PORT=80",
+				"APP__SERVER.FLOAT=1.5",
+				"APP__MAP.ONE_TWO.FLOAT=2.5",
+				"APP__SLICE.1.FLOAT=3.5",
+				"APP__SLICE.+.FLOAT=4.5",
+				"APP__NAME=${HOST}",
+				"APP_SERVER_FLOAT=9",
+				"HOST=example.com",
+			},
+			Separator:       '.',
+			PrefixSeparator: "__",
+			Expand:          true,
+		},
+		Prefix: "app",
+	}
+
+	got := new(Config)
+	if err := EnvOpts(got, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		HTTPPort: 80,
+		Server:   B{Float: 1.5},
+		// With another separator underscores can be in map keys
+		Map:   map[string]B{"one_two": {Float: 2.5}},
+		Slice: []B{{}, {Float: 3.5}, {Float: 4.5}},
+		// Expanded from Environ rather than the process env
+		Name: "example.com",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("structs differ:\nwant:\n%v\n\ngot:\n%v\n", want, got)
+	}
+}
+
+type annotatedConfig struct {
+	_ struct{} `loadcfg:"prefix=svc,tag=cfg"`
+
+	Port int `cfg:"port"`
+	Host struct {
+		Name string `cfg:"name"`
+	} `cfg:"host"`
+}
+
+func TestEnvAnnotated(t *testing.T) {
+	t.Parallel()
+
+	l := Loader{Environ: []string{"SVC_PORT=8080", "SVC_HOST_NAME=example.com", "APP_PORT=1"}}
+
+	got := new(annotatedConfig)
+	if err := l.EnvAnnotated(got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Port != 8080 || got.Host.Name != "example.com" {
+		t.Errorf("values wrong: %#v", got)
+	}
+
+	// The tag defaults to toml
+	defaults := &struct {
+		_    struct{} `loadcfg:"prefix=svc"`
+		Port int      `toml:"port"`
+	}{}
+	if err := l.EnvAnnotated(defaults); err != nil {
+		t.Fatal(err)
+	}
+	if defaults.Port != 8080 {
+		t.Error("port wrong:", defaults.Port)
+	}
+
+	if err := l.EnvAnnotated(new(A)); !errors.Is(err, ErrFieldNotFound) {
+		t.Error("expected an error without an annotation:", err)
+	}
+
+	bad := &struct {
+		_ struct{} `loadcfg:"prefix=svc,file=x.toml"`
+	}{}
+	if err := l.EnvAnnotated(bad); !errors.Is(err, ErrParse) {
+		t.Error("expected an error for an unknown annotation:", err)
+	}
+}
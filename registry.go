@@ -0,0 +1,204 @@
+package loadcfg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// typeSegment is the key segment that chooses the concrete type of an
+// interface map value, eg. PREFIX_PLUGINS_CACHE_TYPE=redis
+const typeSegment = "type"
+
+// registeredType is a concrete type that interface map values can be set to
+type registeredType struct {
+	factory func() interface{}
+	typ     reflect.Type
+}
+
+var registry = struct {
+	sync.RWMutex
+	types map[string]registeredType
+}{types: make(map[string]registeredType)}
+
+// RegisterType makes a concrete type available to maps whose values are an
+// interface, eg. map[string]Plugin. The TYPE segment of an entry selects the
+// type by name and the rest of the entry's env vars set its fields:
+//
+//	RegisterType("redis", func() interface{} { return &Redis{} })
+//	// PREFIX_PLUGINS_CACHE_TYPE=redis
+//	// PREFIX_PLUGINS_CACHE_ADDR=localhost:6379
+//
+// factory should return a pointer so the fields can be set. Registering a
+// name again replaces it.
+func RegisterType(name string, factory func() interface{}) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.types[name] = registeredType{
+		factory: factory,
+		typ:     reflect.TypeOf(factory()),
+	}
+}
+
+// lookupType finds a registered type by name, ignoring case since map keys
+// from env vars are lowercased
+func lookupType(name string) (registeredType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if t, ok := registry.types[name]; ok {
+		return t, true
+	}
+	for registered, t := range registry.types {
+		if strings.EqualFold(registered, name) {
+			return t, true
+		}
+	}
+
+	return registeredType{}, false
+}
+
+// implementations returns the registered types that can be stored in iface in
+// name order
+func implementations(iface reflect.Type) []reflect.Type {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var names []string
+	for name, t := range registry.types {
+		if t.typ != nil && t.typ.AssignableTo(iface) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	types := make([]reflect.Type, len(names))
+	for i, name := range names {
+		types[i] = registry.types[name].typ
+	}
+
+	return types
+}
+
+// registeredName finds the name typ was registered under, the first in name
+// order if there's more than one
+func registeredName(typ reflect.Type) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var names []string
+	for name, t := range registry.types {
+		if t.typ == typ {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+
+	sort.Strings(names)
+	return names[0], true
+}
+
+// interfacePseudoKeys returns the pseudo keys of an interface value at
+// recurse: the type selector and the keys of every registered type that
+// could be stored in it.
+func (l *Loader) interfacePseudoKeys(tag string, recurse []string, iface reflect.Type) ([]string, error) {
+	keys := []string{strings.Join(cloneAndAppend(recurse, typeSegment), ".")}
+	seen := map[string]bool{keys[0]: true}
+
+	for _, typ := range implementations(iface) {
+		newKeys, err := l.envPseudoKeysHelper(tag, recurse, typ)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range newKeys {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// setInterfaceMapVal sets key inside the interface map value at keyObj. The
+// concrete type comes from the existing value or the entry's type key.
+func (w *overwriter) setInterfaceMapVal(obj, keyObj reflect.Value, key []string, val string, opts tagOptions) error {
+	ifaceType := obj.Type().Elem()
+	elem := obj.MapIndex(keyObj)
+	if elem.IsValid() && elem.IsNil() {
+		elem = reflect.Value{}
+	}
+
+	entryKey := strings.Join(w.key[:len(w.key)-len(key)+1], ".")
+	if len(key) == 2 && key[1] == typeSegment {
+		t, err := w.registeredType(entryKey, val, ifaceType)
+		if err != nil {
+			return err
+		}
+		if elem.IsValid() && elem.Elem().Type() == t.typ {
+			// Already the right type, keep what's been set
+			return nil
+		}
+
+		obj.SetMapIndex(keyObj, reflect.ValueOf(t.factory()))
+		return nil
+	}
+
+	// The type key sorts after most field names so it has to be looked up
+	// here, both to create a value and to switch an existing value to a
+	// different type before its fields are set
+	typeName, hasType := w.values[entryKey+"."+typeSegment]
+	if !elem.IsValid() && !hasType {
+		return fmt.Errorf("%w: %s needs a %s to create a value", ErrUnsupportedType, entryKey, typeSegment)
+	}
+
+	if hasType {
+		t, err := w.registeredType(entryKey, typeName, ifaceType)
+		if err != nil {
+			return err
+		}
+		if !elem.IsValid() || elem.Elem().Type() != t.typ {
+			elem = reflect.ValueOf(t.factory())
+		} else {
+			elem = elem.Elem()
+		}
+	} else {
+		elem = elem.Elem()
+	}
+
+	// Values that aren't pointers are copied so they can be modified and
+	// then put back
+	if elem.Kind() != reflect.Ptr {
+		copied := reflect.New(elem.Type()).Elem()
+		copied.Set(elem)
+		elem = copied
+	}
+
+	if err := w.overwriteStructValsHelper(key[1:], val, elem, opts); err != nil {
+		return err
+	}
+
+	obj.SetMapIndex(keyObj, elem)
+	return nil
+}
+
+// registeredType looks up the type called name for the interface map entry
+// at entryKey
+func (w *overwriter) registeredType(entryKey, name string, iface reflect.Type) (registeredType, error) {
+	t, ok := lookupType(name)
+	if !ok {
+		return t, fmt.Errorf("%w: %s: no type registered as %q", ErrUnsupportedType, entryKey, name)
+	}
+	if t.typ == nil || !t.typ.AssignableTo(iface) {
+		return t, fmt.Errorf("%w: %s: type %q (%v) does not implement %s", ErrUnsupportedType, entryKey, name, t.typ, iface)
+	}
+
+	return t, nil
+}
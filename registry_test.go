@@ -0,0 +1,130 @@
+package loadcfg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type plugin interface {
+	Name() string
+}
+
+type redisPlugin struct {
+	Addr string `toml:"addr"`
+	DB   int    `toml:"db"`
+}
+
+func (r *redisPlugin) Name() string { return "redis" }
+
+type filePlugin struct {
+	Path string `toml:"path"`
+}
+
+func (f *filePlugin) Name() string { return "file" }
+
+type pluginConfig struct {
+	Plugins map[string]plugin `toml:"plugins"`
+}
+
+func init() {
+	RegisterType("redis", func() interface{} { return &redisPlugin{} })
+	RegisterType("file", func() interface{} { return &filePlugin{} })
+}
+
+func TestRegisterType(t *testing.T) {
+	keys := setEnvs(
+		"TEST54_PLUGINS_CACHE_TYPE", "redis",
+		"TEST54_PLUGINS_CACHE_ADDR", "localhost:6379",
+		"TEST54_PLUGINS_CACHE_DB", "2",
+		"TEST54_PLUGINS_LOGS_TYPE", "file",
+		"TEST54_PLUGINS_LOGS_PATH", "/var/log/app",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := new(pluginConfig)
+	if err := Env("test54", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]plugin{
+		"cache": &redisPlugin{Addr: "localhost:6379", DB: 2},
+		"logs":  &filePlugin{Path: "/var/log/app"},
+	}
+	if !reflect.DeepEqual(want, got.Plugins) {
+		t.Errorf("plugins wrong, want: %#v, got: %#v", want, got.Plugins)
+	}
+}
+
+func TestRegisterTypeExisting(t *testing.T) {
+	keys := setEnvs(
+		"TEST55_PLUGINS_CACHE_DB", "3",
+	)
+
+	defer unsetEnvs(keys)
+
+	// The type isn't needed when there's already a value
+	got := &pluginConfig{Plugins: map[string]plugin{
+		"cache": &redisPlugin{Addr: "file:6379"},
+	}}
+	if err := Env("test55", "toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (&redisPlugin{Addr: "file:6379", DB: 3}); !reflect.DeepEqual(want, got.Plugins["cache"]) {
+		t.Errorf("cache wrong, want: %#v, got: %#v", want, got.Plugins["cache"])
+	}
+}
+
+func TestRegisterTypeSwitch(t *testing.T) {
+	t.Parallel()
+
+	l := Loader{Environ: fakeEnvs(
+		// addr and db sort before type so they're applied first
+		"APP_PLUGINS_LOGS_TYPE", "redis",
+		"APP_PLUGINS_LOGS_ADDR", "localhost:6379",
+		"APP_PLUGINS_CACHE_TYPE", "redis",
+		"APP_PLUGINS_CACHE_DB", "3",
+	)}
+
+	// Stands in for a file that already filled in the plugins
+	decode := func(obj interface{}) error {
+		obj.(*pluginConfig).Plugins = map[string]plugin{
+			"logs":  &filePlugin{Path: "/var/log/app"},
+			"cache": &redisPlugin{Addr: "file:6379"},
+		}
+		return nil
+	}
+
+	got := new(pluginConfig)
+	if err := l.Load("app", "toml", decode, got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]plugin{
+		// A different type replaces the value
+		"logs": &redisPlugin{Addr: "localhost:6379"},
+		// The same type keeps what was there
+		"cache": &redisPlugin{Addr: "file:6379", DB: 3},
+	}
+	if !reflect.DeepEqual(want, got.Plugins) {
+		t.Errorf("plugins wrong, want: %#v, got: %#v", want, got.Plugins)
+	}
+}
+
+func TestRegisterTypeErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []map[string]string{
+		{"plugins.cache.addr": "localhost"},
+		{"plugins.cache.type": "memcache"},
+	}
+
+	for i, values := range tests {
+		var l Loader
+		if err := l.overwriteStructVals("toml", values, new(pluginConfig)); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%d) expected an unsupported type error: %v", i, err)
+		}
+	}
+}
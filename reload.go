@@ -0,0 +1,49 @@
+package loadcfg
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Reload is the same as TOML except that obj is only changed if the whole
+// load succeeds. The file and env are loaded into a deep copy of obj and only
+// once that has fully succeeded is it copied into obj, so an error never
+// leaves obj partially updated. obj must be a pointer.
+//
+// Since it starts from a copy, defaults set in code before the first load are
+// kept, but so is anything set by an earlier load that has since been removed
+// from the file or env (eg. a map entry). For the same reason env vars that
+// append to a slice (with the + or -1 index) are an error, since each reload
+// would append another element.
+//
+// The final copy into obj is an ordinary write and isn't safe while other
+// goroutines read obj. Either guard obj with a lock that readers also take,
+// or load into a new value and swap readers over to it through a pointer,
+// eg. with atomic.Pointer.
+func Reload(envPrefix, filename string, obj interface{}) error {
+	var l Loader
+	return l.Reload(envPrefix, filename, obj)
+}
+
+// Reload is the same as the package level Reload but uses the Loader's
+// options.
+func (l *Loader) Reload(envPrefix, filename string, obj interface{}) error {
+	val := reflect.ValueOf(obj)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("%w: reload requires a non-nil pointer but got: %T", ErrUnsupportedType, obj)
+	}
+	if err := checkFrozen(obj); err != nil {
+		return err
+	}
+
+	reloader := *l
+	reloader.reloading = true
+
+	fresh := deepCopy(val)
+	if _, err := reloader.TOML(envPrefix, filename, fresh.Interface()); err != nil {
+		return err
+	}
+
+	val.Elem().Set(fresh.Elem())
+	return nil
+}
@@ -0,0 +1,138 @@
+package loadcfg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	keys := setEnvs("TEST22_STRUCT_FLOAT", "5.5")
+
+	defer unsetEnvs(keys)
+
+	got := &A{Int: 1, Struct: B{Float: 1.5}}
+	if err := Reload("test22", "testdata/one.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if got.Struct.Float != 5.5 {
+		t.Error("struct float wrong:", got.Struct.Float)
+	}
+	if g := got.Map["one"].Float; g != 4.5 {
+		t.Error("map float wrong:", g)
+	}
+
+	if err := Reload("test22", "testdata/one.toml", A{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("expected an error for a non-pointer:", err)
+	}
+}
+
+func TestReloadError(t *testing.T) {
+	keys := setEnvs(
+		"TEST23_INT", "6",
+		"TEST23_STRUCT_FLOAT", "notafloat",
+	)
+
+	defer unsetEnvs(keys)
+
+	got := &A{Int: 1, Struct: B{Float: 1.5}}
+	if err := Reload("test23", "testdata/one.toml", got); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got.Int != 1 || got.Struct.Float != 1.5 || got.Map != nil {
+		t.Errorf("original should be untouched: %#v", got)
+	}
+}
+
+func TestReloadKeepsDefaults(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		Port int          `toml:"port"`
+		Int  int          `toml:"int"`
+		Map  map[string]B `toml:"map"`
+	}
+
+	l := Loader{Environ: fakeEnvs("APP_MAP_THREE_FLOAT", "6.5")}
+
+	got := &Config{Port: 8080, Map: map[string]B{"zero": {Float: 1}}}
+	if err := l.Reload("app", "testdata/one.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Port != 8080 {
+		t.Error("the default port should be kept:", got.Port)
+	}
+	if got.Int != 5 {
+		t.Error("int wrong:", got.Int)
+	}
+	if len(got.Map) != 4 || got.Map["zero"].Float != 1 || got.Map["three"].Float != 6.5 {
+		t.Error("map wrong:", got.Map)
+	}
+}
+
+func TestReloadErrorSharedValues(t *testing.T) {
+	t.Parallel()
+
+	l := Loader{Environ: fakeEnvs(
+		"APP_MAP_ONE_FLOAT", "6.5",
+		"APP_SLICE_0_FLOAT", "7.5",
+		"APP_STRUCTPTR_FLOAT", "8.5",
+		"APP_STRUCT_FLOAT", "notafloat",
+	)}
+
+	// Maps, slices and pointers in the original must not be written to
+	// through the copy being loaded
+	got := &A{
+		Map:       map[string]B{"one": {Float: 1}},
+		Slice:     []B{{Float: 2}},
+		StructPtr: &B{Float: 3},
+	}
+	if err := l.Reload("app", "testdata/missing.toml", got); !errors.Is(err, ErrParse) {
+		t.Fatal("expected a parse error:", err)
+	}
+
+	if len(got.Map) != 1 || got.Map["one"].Float != 1 {
+		t.Error("map changed:", got.Map)
+	}
+	if got.Slice[0].Float != 2 {
+		t.Error("slice changed:", got.Slice)
+	}
+	if got.StructPtr.Float != 3 {
+		t.Error("struct pointer changed:", got.StructPtr)
+	}
+}
+
+func TestReloadAppend(t *testing.T) {
+	t.Parallel()
+
+	type Config struct {
+		S []string `toml:"s"`
+	}
+
+	for _, env := range []string{"PRL_S_+=x", "PRL_S_-1=x"} {
+		l := Loader{Environ: []string{env}}
+		got := &Config{S: []string{"a"}}
+		for i := 0; i < 3; i++ {
+			if err := l.Reload("prl", "testdata/missing.toml", got); !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("%s: expected an error for appending on reload: %v", env, err)
+			}
+		}
+		if len(got.S) != 1 || got.S[0] != "a" {
+			t.Errorf("%s: slice should be untouched: %v", env, got.S)
+		}
+	}
+
+	l := Loader{Environ: []string{"PRL_S_0=x"}}
+	got := &Config{S: []string{"a"}}
+	if err := l.Reload("prl", "testdata/missing.toml", got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.S) != 1 || got.S[0] != "x" {
+		t.Error("indexes should still be allowed:", got.S)
+	}
+}
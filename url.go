@@ -0,0 +1,46 @@
+package loadcfg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/BurntSushi/toml"
+)
+
+// TOMLURL is the same as TOML but the file is fetched with a GET request to
+// url. Unlike TOML a missing file is an error, any response status other
+// than 200 is returned as an error.
+func TOMLURL(ctx context.Context, envPrefix, url string, obj interface{}) (toml.MetaData, error) {
+	var l Loader
+	return l.TOMLURL(ctx, envPrefix, url, obj)
+}
+
+// TOMLURL is the same as the package level TOMLURL but uses the Loader's
+// options.
+func (l *Loader) TOMLURL(ctx context.Context, envPrefix, url string, obj interface{}) (m toml.MetaData, err error) {
+	err = l.load(envPrefix, "toml", obj, func() (*toml.MetaData, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+		}
+
+		m, err = toml.DecodeReader(resp.Body, obj)
+		if err != nil {
+			return nil, err
+		}
+		return &m, nil
+	})
+
+	return m, err
+}
@@ -0,0 +1,45 @@
+package loadcfg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTOMLURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config.toml" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "testdata/one.toml")
+	}))
+	defer server.Close()
+
+	keys := setEnvs("TEST65_INT", "6")
+
+	defer unsetEnvs(keys)
+
+	got := new(A)
+	if _, err := TOMLURL(context.Background(), "test65", server.URL+"/config.toml", got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Int != 6 {
+		t.Error("int wrong:", got.Int)
+	}
+	if g := got.Map["two"].Float; g != 4.5 {
+		t.Error("map float wrong:", g)
+	}
+
+	if _, err := TOMLURL(context.Background(), "test65", server.URL+"/missing.toml", new(A)); err == nil {
+		t.Error("expected an error for a 404")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := TOMLURL(ctx, "test65", server.URL+"/config.toml", new(A)); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
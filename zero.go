@@ -0,0 +1,96 @@
+package loadcfg
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ZeroFields returns the dotted paths of all the fields in obj that are still
+// at their zero value, typically after loading has completed. Map keys and
+// slice indexes that can be found in obj are used in place of wildcards.
+// Empty maps and slices are reported as a single path.
+func ZeroFields(structTag string, obj interface{}) []string {
+	var zeros []string
+	zeroFieldsHelper(structTag, nil, reflect.ValueOf(obj), &zeros)
+	return zeros
+}
+
+func zeroFieldsHelper(tag string, path []string, val reflect.Value, zeros *[]string) {
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			// Walk a zero value so all the fields behind the pointer are
+			// reported
+			val = reflect.Zero(val.Type().Elem())
+		} else {
+			val = val.Elem()
+		}
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+		if isLeafStruct(val.Type()) {
+			break
+		}
+
+		typ := val.Type()
+		n := typ.NumField()
+		for i := 0; i < n; i++ {
+			name, opts, ok := getTag(typ.Field(i), tag)
+			if !ok {
+				continue
+			}
+
+			fieldPath := cloneAndAppend(path, name)
+			if opts.has("squash") {
+				fieldPath = path
+			}
+
+			zeroFieldsHelper(tag, fieldPath, val.Field(i), zeros)
+		}
+
+		return
+	case reflect.Map:
+		if val.Len() == 0 {
+			break
+		}
+
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			zeroFieldsHelper(tag, cloneAndAppend(path, k.String()), val.MapIndex(k), zeros)
+		}
+
+		return
+	case reflect.Slice:
+		if val.Len() == 0 {
+			break
+		}
+
+		elemType := val.Type().Elem()
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+
+		switch elemType.Kind() {
+		case reflect.Map, reflect.Struct, reflect.Slice:
+			if isLeafStruct(elemType) {
+				break
+			}
+
+			for i := 0; i < val.Len(); i++ {
+				zeroFieldsHelper(tag, cloneAndAppend(path, strconv.Itoa(i)), val.Index(i), zeros)
+			}
+		}
+
+		return
+	}
+
+	if len(path) != 0 && val.IsZero() {
+		*zeros = append(*zeros, strings.Join(path, "."))
+	}
+}
@@ -0,0 +1,39 @@
+package loadcfg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestZeroFields(t *testing.T) {
+	t.Parallel()
+
+	type C struct {
+		Name    string         `toml:"name"`
+		Port    int            `toml:"port"`
+		Tags    []string       `toml:"tags"`
+		Limits  map[string]int `toml:"limits"`
+		Servers []B            `toml:"servers"`
+		Ptr     *B             `toml:"ptr"`
+		Ignored int            `toml:"-"`
+	}
+
+	obj := &C{
+		Name:    "app",
+		Limits:  map[string]int{"a": 1, "b": 0},
+		Servers: []B{{Float: 1.5}, {}},
+	}
+
+	got := ZeroFields("toml", obj)
+	want := []string{
+		"port",
+		"tags",
+		"limits.b",
+		"servers.1.float",
+		"ptr.float",
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("zero fields wrong\nwant: %v\ngot:  %v", want, got)
+	}
+}